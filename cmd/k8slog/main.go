@@ -1,25 +1,21 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"os"
-	"path/filepath"
 
-	"github.com/nouney/k8slog/pkg/colorpicker"
+	"github.com/nouney/k8slog/pkg/cli"
 	"github.com/nouney/k8slog/pkg/k8s"
-	"github.com/nouney/k8slog/pkg/k8slog"
 	"github.com/spf13/cobra"
-	"k8s.io/client-go/util/homedir"
 )
 
 var (
-	flagFollow     = false
-	flagColors     = true
-	flagTimestamp  = true
-	flagPrefix     = true
 	flagKubeconfig = ""
-	flagJSONFields = []string{}
+	flagContext    = ""
+	flagCluster    = ""
+	flagUser       = ""
+	flagAs         = ""
+	flagAsGroups   = []string{}
 )
 
 func main() {
@@ -35,74 +31,72 @@ var cmd = &cobra.Command{
 	Long:  ``,
 	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		k8s, err := k8s.NewClient(flagKubeconfig)
+		args, err := cli.ApplyConfig(cmd.Flags(), args)
 		if err != nil {
 			return err
 		}
-
-		klog := k8slog.New(
-			k8s,
-			k8slog.WithOptsTimestamps(flagTimestamp),
-			k8slog.WithOptsJSONFields(flagJSONFields...),
-			k8slog.WithOptsFollow(flagFollow),
-		)
-		out, err := klog.Logs(args...)
+		if !cli.NeedsCluster(args) {
+			return cli.Run(nil, args)
+		}
+		k8s, err := newClient()
 		if err != nil {
 			return err
 		}
+		return cli.Run(k8s, args)
+	},
+}
+
+func init() {
+	cmd.PersistentFlags().StringVar(&flagKubeconfig, "kubeconfig", "", "path to the kubeconfig file (default: $KUBECONFIG, then ~/.kube/config)")
+	cmd.PersistentFlags().StringVar(&flagContext, "context", "", "name of the kubeconfig context to use")
+	cmd.PersistentFlags().StringVar(&flagCluster, "cluster", "", "name of the kubeconfig cluster to use")
+	cmd.PersistentFlags().StringVar(&flagUser, "user", "", "name of the kubeconfig user to use")
+	cmd.PersistentFlags().StringVar(&flagAs, "as", "", "username to impersonate for the operation")
+	cmd.PersistentFlags().StringSliceVar(&flagAsGroups, "as-group", nil, "group to impersonate for the operation, can be repeated")
+	cli.AddFlags(cmd.Flags())
+	cli.AddReplayFlags(replayCmd.Flags())
+	cmd.AddCommand(replayCmd)
+	cli.AddServeFlags(serveCmd.Flags())
+	cmd.AddCommand(serveCmd)
+}
 
-		cp := colorpicker.New()
-		format := formatter(cp)
-		for {
-			logline, ok := <-out
-			if !ok {
-				break
-			}
-			fmt.Print(format(&logline))
+var replayCmd = &cobra.Command{
+	Use:   "replay SESSION",
+	Short: "Print the logs of a session recorded with --record",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := cli.ApplyConfig(cmd.Flags(), nil); err != nil {
+			return err
 		}
-		return nil
+		return cli.Replay(args[0])
 	},
 }
 
-func formatter(cp *colorpicker.ColorPicker) func(logline *k8slog.LogLine) string {
-	if !flagPrefix {
-		return func(logline *k8slog.LogLine) string {
-			return logline.Line
-		}
-	}
-	var podName func(*k8slog.LogLine) string
-	if flagColors {
-		podName = func(logline *k8slog.LogLine) string {
-			color := cp.Pick(logline.Namespace + "/" + string(logline.Type) + "/" + logline.Name)
-			return color.Sprint(logline.Pod)
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Stream logs over HTTP as Server-Sent Events (/sse) or WebSocket messages (/ws)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := cli.ApplyConfig(cmd.Flags(), nil); err != nil {
+			return err
 		}
-	} else {
-		podName = func(logline *k8slog.LogLine) string {
-			return logline.Pod
+		k8s, err := newClient()
+		if err != nil {
+			return err
 		}
-	}
-	return func(logline *k8slog.LogLine) string {
-		return concat("[", logline.Namespace, "][", podName(logline), "]: ", logline.Line)
-	}
-}
-
-func concat(strs ...string) string {
-	var buffer bytes.Buffer
-	for _, str := range strs {
-		buffer.WriteString(str)
-	}
-	return buffer.String()
+		return cli.Serve(k8s)
+	},
 }
 
-func init() {
-	defaultKubeconfig := ""
-	if home := homedir.HomeDir(); home != "" {
-		defaultKubeconfig = filepath.Join(home, ".kube", "config")
-	}
-	cmd.PersistentFlags().StringVar(&flagKubeconfig, "kubeconfig", defaultKubeconfig, "absolute path to the kubeconfig file")
-	cmd.Flags().BoolVarP(&flagColors, "colors", "c", true, "enable colors")
-	cmd.Flags().BoolVarP(&flagFollow, "follow", "f", false, "follow the logs")
-	cmd.Flags().BoolVarP(&flagTimestamp, "timestamp", "t", true, "print timestamp")
-	cmd.Flags().BoolVarP(&flagPrefix, "prefix", "p", true, "print prefix")
-	cmd.Flags().StringSliceVarP(&flagJSONFields, "json", "j", nil, "json log only, print a specific field")
+// newClient creates the kubernetes client matching the flags
+func newClient() (*k8s.Client, error) {
+	opts := append(
+		cli.ClientOpts(),
+		k8s.WithOptsKubeconfig(flagKubeconfig),
+		k8s.WithOptsContext(flagContext),
+		k8s.WithOptsCluster(flagCluster),
+		k8s.WithOptsUser(flagUser),
+		k8s.WithOptsImpersonate(flagAs, flagAsGroups...),
+	)
+	return k8s.NewClient(opts...)
 }
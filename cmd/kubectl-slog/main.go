@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nouney/k8slog/pkg/cli"
+	"github.com/nouney/k8slog/pkg/k8s"
+	"github.com/nouney/k8slog/pkg/k8slog"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// configFlags are kubectl's global flags (namespace, context, kubeconfig, server, token, ...)
+var configFlags = genericclioptions.NewConfigFlags(true)
+
+func main() {
+	if err := cmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+var cmd = &cobra.Command{
+	Use:   "kubectl slog [TYPE NAME | TYPE/NAME | NAME]...",
+	Short: "Print the logs of pods controlled by kubernetes resources",
+	Long:  ``,
+	Example: `  # Print logs of pods controlled by deployment "api" in the current namespace
+  kubectl slog deploy api
+
+  # Follow logs of pods controlled by deployment "api" in namespace "prod"
+  kubectl slog deploy/api -n prod -f`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		args, err := cli.ApplyConfig(cmd.Flags(), args)
+		if err != nil {
+			return err
+		}
+		if !cli.NeedsCluster(args) {
+			return cli.Run(nil, args)
+		}
+		namespace, _, err := configFlags.ToRawKubeConfigLoader().Namespace()
+		if err != nil {
+			return err
+		}
+		ress, err := k8slog.ResourcesFromArgs(namespace, args...)
+		if err != nil {
+			return err
+		}
+		restConfig, err := configFlags.ToRESTConfig()
+		if err != nil {
+			return err
+		}
+		k8s, err := k8s.NewClientForConfig(restConfig, cli.ClientOpts()...)
+		if err != nil {
+			return err
+		}
+		return cli.Run(k8s, ress)
+	},
+}
+
+func init() {
+	configFlags.AddFlags(cmd.PersistentFlags())
+	cli.AddFlags(cmd.Flags())
+	cli.AddReplayFlags(replayCmd.Flags())
+	cmd.AddCommand(replayCmd)
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay SESSION",
+	Short: "Print the logs of a session recorded with --record",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := cli.ApplyConfig(cmd.Flags(), nil); err != nil {
+			return err
+		}
+		return cli.Replay(args[0])
+	},
+}
@@ -0,0 +1,210 @@
+// Package batch sends log lines to a remote server in batches, from a single goroutine
+package batch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/nouney/k8slog/pkg/k8slog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultSize is the default number of lines per batch
+	defaultSize = 1000
+	// defaultWait is the default maximum time a line waits before being sent
+	defaultWait = time.Second
+	// defaultRetryTimeout is the default time after which a failing batch is abandoned
+	defaultRetryTimeout = time.Minute
+	// maxPending is the number of full batches waiting to be sent before Write blocks
+	maxPending = 4
+)
+
+// Batch is a batch of lines being built
+type Batch interface {
+	// Add adds a line to the batch
+	Add(l *k8slog.LogLine)
+	// Len returns the number of lines of the batch
+	Len() int
+	// Encode returns the body of the request sending the batch
+	Encode() ([]byte, error)
+}
+
+// Sender sends the body of a batch, the errors wrapped with backoff.Permanent aren't retried
+type Sender func(body []byte) error
+
+// Batcher sends the lines in batches, when a batch is full or its oldest line waited long enough.
+//
+// The batches are sent one at a time, in order, by a single goroutine. Failing sends are retried with
+// an exponential backoff, so Write only blocks when several full batches are waiting to be sent.
+type Batcher struct {
+	newBatch     func() Batch
+	send         Sender
+	size         int
+	wait         time.Duration
+	retryTimeout time.Duration
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	current Batch
+	pending []Batch
+	err     error
+	ready   chan struct{}
+	flushes chan chan error
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Opts is an option used to configure Batcher
+type Opts func(b *Batcher)
+
+// WithOptsBatch configures the batches (default: 1000 lines, 1s).
+//
+// A batch is sent when it has size lines or its oldest line waited for wait.
+func WithOptsBatch(size int, wait time.Duration) Opts {
+	return func(b *Batcher) {
+		b.size = size
+		b.wait = wait
+	}
+}
+
+// WithOptsRetryTimeout configures the time after which a failing batch is abandoned (default: 1m)
+func WithOptsRetryTimeout(timeout time.Duration) Opts {
+	return func(b *Batcher) {
+		b.retryTimeout = timeout
+	}
+}
+
+// New creates a new Batcher building its batches with newBatch and sending them with send
+func New(newBatch func() Batch, send Sender, opts ...Opts) *Batcher {
+	b := &Batcher{
+		newBatch:     newBatch,
+		send:         send,
+		size:         defaultSize,
+		wait:         defaultWait,
+		retryTimeout: defaultRetryTimeout,
+		current:      newBatch(),
+		ready:        make(chan struct{}, 1),
+		flushes:      make(chan chan error),
+		stop:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	for _, opt := range opts {
+		opt(b)
+	}
+	go b.run()
+	return b
+}
+
+// Write adds the line to the current batch, it returns the error of the last batches sent, if any
+func (b *Batcher) Write(l *k8slog.LogLine) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.pending) >= maxPending {
+		b.cond.Wait()
+	}
+	b.current.Add(l)
+	if b.current.Len() >= b.size {
+		b.enqueue()
+	}
+	err := b.err
+	b.err = nil
+	return err
+}
+
+// enqueue hands the current batch over to the sending goroutine, b.mu must be held
+func (b *Batcher) enqueue() {
+	if b.current.Len() == 0 {
+		return
+	}
+	b.pending = append(b.pending, b.current)
+	b.current = b.newBatch()
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Flush sends the current batch and waits for the batches to be sent, it returns the first error
+func (b *Batcher) Flush() error {
+	res := make(chan error)
+	b.flushes <- res
+	return <-res
+}
+
+// Close sends the remaining lines and stops the goroutine, it returns the first error not reported yet
+func (b *Batcher) Close() error {
+	close(b.stop)
+	<-b.stopped
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// run sends the batches until the Batcher is closed
+func (b *Batcher) run() {
+	defer close(b.stopped)
+	var tick <-chan time.Time
+	if b.wait > 0 {
+		ticker := time.NewTicker(b.wait)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-b.ready:
+			b.fail(b.sendPending(false))
+		case <-tick:
+			b.fail(b.sendPending(true))
+		case res := <-b.flushes:
+			res <- b.sendPending(true)
+		case <-b.stop:
+			b.fail(b.sendPending(true))
+			return
+		}
+	}
+}
+
+// fail keeps the first error, reported by the next Write or by Close
+func (b *Batcher) fail(err error) {
+	b.mu.Lock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.mu.Unlock()
+}
+
+// sendPending sends the full batches, then the current one if all is set, it returns the first error
+func (b *Batcher) sendPending(all bool) error {
+	b.mu.Lock()
+	if all {
+		b.enqueue()
+	}
+	var first error
+	for len(b.pending) > 0 {
+		batch := b.pending[0]
+		b.pending = b.pending[1:]
+		b.cond.Broadcast()
+		b.mu.Unlock()
+		err := b.sendBatch(batch)
+		b.mu.Lock()
+		if first == nil {
+			first = err
+		}
+	}
+	b.mu.Unlock()
+	return first
+}
+
+// sendBatch encodes and sends a batch, retrying with an exponential backoff
+func (b *Batcher) sendBatch(batch Batch) error {
+	body, err := batch.Encode()
+	if err != nil {
+		return errors.Wrap(err, "encode")
+	}
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = b.retryTimeout
+	return backoff.Retry(func() error { return b.send(body) }, bo)
+}
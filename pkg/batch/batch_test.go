@@ -0,0 +1,124 @@
+package batch
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+// lines is a batch of the lines' messages, encoded one per line
+type lines []string
+
+func (b *lines) Add(l *k8slog.LogLine) {
+	*b = append(*b, l.Line)
+}
+
+func (b *lines) Len() int {
+	return len(*b)
+}
+
+func (b *lines) Encode() ([]byte, error) {
+	return []byte(strings.Join(*b, "\n")), nil
+}
+
+func newLines() Batch {
+	return &lines{}
+}
+
+func TestBatcherSendsInOrder(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	inFlight := 0
+	send := func(body []byte) error {
+		mu.Lock()
+		inFlight++
+		if inFlight > 1 {
+			t.Error("batches are sent concurrently")
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		inFlight--
+		sent = append(sent, string(body))
+		mu.Unlock()
+		return nil
+	}
+	b := New(newLines, send, WithOptsBatch(3, time.Millisecond))
+	for i := 0; i < 100; i++ {
+		if err := b.Write(&k8slog.LogLine{Line: strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var all []string
+	for _, body := range sent {
+		batch := strings.Split(body, "\n")
+		if len(batch) > 3 {
+			t.Errorf("batch of %d lines, want at most 3", len(batch))
+		}
+		all = append(all, batch...)
+	}
+	if len(all) != 100 {
+		t.Fatalf("%d lines sent, want 100", len(all))
+	}
+	for i, line := range all {
+		if line != strconv.Itoa(i) {
+			t.Fatalf("line %d is %s, the batches are out of order", i, line)
+		}
+	}
+}
+
+func TestBatcherWriteDoesntWaitForRetries(t *testing.T) {
+	release := make(chan struct{})
+	send := func(body []byte) error {
+		<-release
+		return nil
+	}
+	b := New(newLines, send, WithOptsBatch(1, 0))
+	done := make(chan struct{})
+	go func() {
+		// a batch being sent, and the maximum of batches waiting
+		for i := 0; i < maxPending+1; i++ {
+			b.Write(&k8slog.LogLine{Line: "line"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write blocked while a batch was being sent")
+	}
+	close(release)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatcherErrors(t *testing.T) {
+	calls := 0
+	send := func(body []byte) error {
+		calls++
+		return backoff.Permanent(errors.New("rejected"))
+	}
+	b := New(newLines, send, WithOptsBatch(10, 0))
+	b.Write(&k8slog.LogLine{Line: "a"})
+	if err := b.Flush(); err == nil || err.Error() != "rejected" {
+		t.Errorf("Flush() = %v, want the send error", err)
+	}
+	if calls != 1 {
+		t.Errorf("%d sends, a permanent error must not be retried", calls)
+	}
+	// the error was returned by Flush, it isn't reported again
+	b.Write(&k8slog.LogLine{Line: "b"})
+	if err := b.Close(); err == nil {
+		t.Error("Close should report the failure of the last batch")
+	}
+}
@@ -0,0 +1,44 @@
+package batch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/cenkalti/backoff"
+)
+
+// HTTPSender returns a Sender posting the bodies to url as JSON with the client.
+//
+// prepare (optional) sets the other headers of the requests, e.g. for authentication.
+// A response whose status isn't 2xx is an error, which is permanent unless retryable returns true for the status.
+func HTTPSender(client *http.Client, url string, prepare func(req *http.Request), retryable func(status int) bool) Sender {
+	return func(body []byte) error {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if prepare != nil {
+			prepare(req)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 == 2 {
+			io.Copy(ioutil.Discard, resp.Body)
+			return nil
+		}
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		if !retryable(resp.StatusCode) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}
+}
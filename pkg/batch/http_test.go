@@ -0,0 +1,59 @@
+package batch
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cenkalti/backoff"
+)
+
+func TestHTTPSender(t *testing.T) {
+	var status int
+	var body, contentType, tenant string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body, contentType, tenant = string(data), r.Header.Get("Content-Type"), r.Header.Get("X-Scope-OrgID")
+		w.WriteHeader(status)
+		w.Write([]byte("rate limited\n"))
+	}))
+	defer ts.Close()
+	send := HTTPSender(http.DefaultClient, ts.URL, func(req *http.Request) {
+		req.Header.Set("X-Scope-OrgID", "team-a")
+	}, func(status int) bool {
+		return status == http.StatusTooManyRequests || status/100 == 5
+	})
+
+	tests := []struct {
+		status    int
+		err       string
+		permanent bool
+	}{
+		{status: http.StatusOK},
+		{status: http.StatusNoContent},
+		{status: http.StatusTooManyRequests, err: "429 Too Many Requests: rate limited"},
+		{status: http.StatusServiceUnavailable, err: "503 Service Unavailable: rate limited"},
+		{status: http.StatusBadRequest, err: "400 Bad Request: rate limited", permanent: true},
+	}
+	for _, tt := range tests {
+		status = tt.status
+		err := send([]byte(`{"streams":[]}`))
+		if body != `{"streams":[]}` || contentType != "application/json" || tenant != "team-a" {
+			t.Errorf("status %d: request %q, %q, %q", tt.status, body, contentType, tenant)
+		}
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("status %d: %v", tt.status, err)
+			}
+			continue
+		}
+		permanent, ok := err.(*backoff.PermanentError)
+		if ok {
+			err = permanent.Err
+		}
+		if err == nil || err.Error() != tt.err || ok != tt.permanent {
+			t.Errorf("status %d: error %v (permanent %t), want %q (permanent %t)", tt.status, err, ok, tt.err, tt.permanent)
+		}
+	}
+}
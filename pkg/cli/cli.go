@@ -0,0 +1,426 @@
+// Package cli contains the command line logic shared by k8slog and kubectl-slog
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/nouney/k8slog/pkg/colorpicker"
+	"github.com/nouney/k8slog/pkg/k8s"
+	"github.com/nouney/k8slog/pkg/k8slog"
+	"github.com/nouney/k8slog/pkg/lineexpr"
+	"github.com/nouney/k8slog/pkg/redact"
+	"github.com/spf13/pflag"
+)
+
+var (
+	flagFollow       = false
+	flagColors       = true
+	flagTimestamp    = true
+	flagPrefix       = true
+	flagJSONFields   = []string{}
+	flagBufferSize   = 1024
+	flagBufferPolicy = "block"
+	flagDropNotices  = 10 * time.Second
+	flagCollapse     = "none"
+	flagLineRate     = 0
+	flagMaxRequests  = 50
+	flagQPS          = float32(0)
+	flagBurst        = 0
+	flagRetry        = k8slog.DefaultRetryPolicy
+	flagQuiet        = false
+	flagOutput       = "text"
+	flagSummary      = false
+	flagK8sEvents    = false
+	flagMetadata     = false
+	flagAnnotations  = []string{}
+	flagWhere        = []string{}
+	flagFilters      = []string{}
+	flagSetters      = []string{}
+	flagRedact       = false
+	flagRedactRules  = []string{}
+	flagRedactFields = []string{}
+	flagTemplate     = ""
+	flagColorBy      = "resource"
+	flagPalette      = []string{}
+
+	flagPrefixTemplate = ""
+	flagPrefixShorten  = false
+	flagPrefixAlign    = true
+
+	flagTee    = false
+	flagRecord = ""
+
+	// cluster is the API server of the cluster, used to color by cluster
+	cluster = ""
+)
+
+// AddFlags adds the logs and output flags to the flag set
+func AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&flagConfig, "config", "", "path to the configuration file (default: ~/.config/k8slog/config.yaml)")
+	flags.StringVar(&flagProfile, "profile", "", "name of the configuration file's profile to use")
+	flags.BoolVarP(&flagColors, "colors", "c", true, "enable colors (default: disabled if stdout is not a terminal or NO_COLOR is set)")
+	flags.StringVar(&flagColorBy, "color-by", "resource", "what the prefix's color depends on: pod, resource, namespace, container or cluster")
+	flags.StringSliceVar(&flagPalette, "palette", nil, "colors of the prefix, e.g. red,bold+208,#ff8800 (see README)")
+	flags.BoolVarP(&flagFollow, "follow", "f", false, "follow the logs")
+	flags.BoolVarP(&flagTimestamp, "timestamp", "t", true, "print timestamp")
+	flags.BoolVarP(&flagPrefix, "prefix", "p", true, "print prefix")
+	flags.StringVar(&flagPrefixTemplate, "prefix-template", "", "go template of the prefix, e.g. '[{{.Namespace}}][{{color .ShortPod}}][{{.Container}}]' (see README)")
+	flags.BoolVar(&flagPrefixShorten, "prefix-shorten", false, "drop the prefix segments identical for all the resources and strip the ReplicaSet hash of pod names")
+	flags.BoolVar(&flagPrefixAlign, "prefix-align", true, "pad the prefix so the lines are aligned")
+	flags.BoolVarP(&flagQuiet, "quiet", "q", false, "don't print pod lifecycle events (new pod, container started, ...)")
+	flags.StringVarP(&flagOutput, "output", "o", "text", "output format: text, json or template")
+	flags.BoolVar(&flagSummary, "summary", false, "print the patterns of the lines with their count, first and last time, pods and a sample, instead of the lines")
+	flags.StringVar(&flagTemplate, "template", "", "go template used by -o template, e.g. '{{.Pod}} {{.Labels.version}}: {{.Line}}'")
+	flags.BoolVar(&flagMetadata, "metadata", false, "retrieve the pods' metadata (labels, node, IP, owner, image, restarts)")
+	flags.StringSliceVar(&flagAnnotations, "annotations", nil, "annotations of the pods to include in the metadata")
+	flags.StringArrayVar(&flagWhere, "where", nil, "only print lines whose field has the value (field=value), e.g. node=ip-10-0-1-2 or label.version=v2")
+	flags.StringArrayVar(&flagFilters, "filter", nil, "only print lines for which the expression is true, e.g. 'level == \"error\" || duration_ms > 1000' (see README)")
+	flags.StringArrayVar(&flagSetters, "set", nil, "set a field of JSON lines, or the line, to the value of an expression, e.g. 'msg = upper(msg)'")
+	flags.BoolVar(&flagRedact, "redact", false, "mask JWTs, AWS keys, authorization credentials, emails and credit card numbers")
+	flags.StringArrayVar(&flagRedactRules, "redact-pattern", nil, "mask the matches of this regular expression, or its group named secret, e.g. 'password=(?P<secret>\\S+)'")
+	flags.StringSliceVar(&flagRedactFields, "redact-field", nil, "mask the values of these fields of JSON lines, e.g. password,token")
+	flags.BoolVar(&flagK8sEvents, "events", false, "interleave the kubernetes events of the resources and their pods with the logs")
+	flags.StringSliceVarP(&flagJSONFields, "json", "j", nil, "json log only, print a specific field")
+	flags.IntVar(&flagBufferSize, "buffer-size", 1024, "number of lines buffered per pod, 0 to disable")
+	flags.StringVar(&flagBufferPolicy, "buffer-policy", "block", "behavior when a pod's buffer is full: block, drop-oldest or drop-newest")
+	flags.DurationVar(&flagDropNotices, "drop-notices", 10*time.Second, "interval between notices of dropped lines, 0 to disable")
+	flags.StringVar(&flagCollapse, "collapse", "none", "collapse the consecutive repeated lines of a container: none, exact or normalized (ignoring numbers and IDs)")
+	flags.IntVar(&flagLineRate, "max-line-rate", 0, "maximum number of lines per second of a pod, the others are counted, 0 for unlimited")
+	flags.IntVar(&flagMaxRequests, "max-log-requests", 50, "maximum number of concurrent log streams, 0 for unlimited (the streams beyond the limit are queued)")
+	flags.Float32Var(&flagQPS, "qps", 0, "maximum queries per second to the API server (default: 5)")
+	flags.IntVar(&flagBurst, "burst", 0, "maximum burst of queries to the API server (default: 10)")
+	addSinkFlags(flags)
+	flags.BoolVar(&flagTee, "tee", false, "also print the logs on stdout when they're written to files or sent elsewhere")
+	flags.StringVar(&flagRecord, "record", "", "record the session to this file, see the replay command")
+	flags.DurationVar(&flagRetry.InitialInterval, "retry-interval", flagRetry.InitialInterval, "initial delay between two retries of a failing log stream")
+	flags.DurationVar(&flagRetry.MaxInterval, "retry-max-interval", flagRetry.MaxInterval, "maximum delay between two retries of a failing log stream")
+	flags.DurationVar(&flagRetry.MaxElapsedTime, "retry-timeout", flagRetry.MaxElapsedTime, "time after which a failing log stream is abandoned, 0 for never")
+	flags.DurationVar(&flagRetry.PendingTimeout, "pending-timeout", flagRetry.PendingTimeout, "time after which a container that can't start is abandoned, 0 for never")
+}
+
+// ClientOpts returns the kubernetes client options matching the flags
+func ClientOpts() []k8s.Opts {
+	return []k8s.Opts{k8s.WithOptsRateLimit(flagQPS, flagBurst)}
+}
+
+// Run retrieves the logs of the resources and prints them on stdout
+//
+// The kubernetes client may be nil if all the resources are local sources (see NeedsCluster).
+func Run(k8s *k8s.Client, ress []string) error {
+	conds, err := parseWhere(flagWhere)
+	if err != nil {
+		return err
+	}
+	if k8s != nil {
+		cluster = k8s.CoreV1().RESTClient().Get().URL().Host
+	}
+	cp, err := colorPicker()
+	if err != nil {
+		return err
+	}
+	format, err := formatter(cp, ress)
+	if err != nil {
+		return err
+	}
+	opts, err := logsOpts(flagFollow, len(conds) > 0 || strings.Contains(flagPrefixTemplate, ".Node"))
+	if err != nil {
+		return err
+	}
+	if flagRecord != "" {
+		file, err := os.Create(flagRecord)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		recorder, err := k8slog.NewRecorder(file, ress...)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, k8slog.WithOptsRecorder(recorder))
+		defer func() {
+			if err := recorder.Err(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+	}
+	klog := k8slog.New(k8s, opts...)
+	out, err := klog.Logs(ress...)
+	if err != nil {
+		return err
+	}
+	return printLines(klog, out, conds, format)
+}
+
+// logsOpts returns the k8slog client options matching the flags, metadata is forced if needed
+func logsOpts(follow, metadata bool) ([]k8slog.Opts, error) {
+	policy, err := k8slog.ParseBufferPolicy(flagBufferPolicy)
+	if err != nil {
+		return nil, err
+	}
+	collapse, err := k8slog.ParseCollapseMode(flagCollapse)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := pipelineOpts()
+	if err != nil {
+		return nil, err
+	}
+	return append(pipeline,
+		k8slog.WithOptsTimestamps(flagTimestamp),
+		k8slog.WithOptsFollow(follow),
+		k8slog.WithOptsBuffer(flagBufferSize, policy),
+		k8slog.WithOptsDropNotices(flagDropNotices),
+		k8slog.WithOptsCollapse(collapse),
+		k8slog.WithOptsLineRate(flagLineRate),
+		k8slog.WithOptsMaxLogRequests(flagMaxRequests),
+		k8slog.WithOptsRetryPolicy(flagRetry),
+		// --quiet only hides the lifecycle events, the file sink records the deleted pods in its manifest
+		k8slog.WithOptsEvents(!flagQuiet || flagOutputDir != ""),
+		k8slog.WithOptsK8sEvents(flagK8sEvents),
+		k8slog.WithOptsPodMetadata(metadata || flagMetadata || len(flagAnnotations) > 0, flagAnnotations...),
+	), nil
+}
+
+// pipelineOpts returns the processors matching the flags: the redaction, the expressions of --filter
+// and --set, then the --json projection
+func pipelineOpts() ([]k8slog.Opts, error) {
+	var opts []k8slog.Opts
+	if len(flagFilters) > 0 || len(flagSetters) > 0 {
+		opts = append(opts, k8slog.WithOptsProcessor(k8slog.StageParse, k8slog.JSONParser))
+		program, err := lineexpr.New(flagFilters, flagSetters)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts,
+			k8slog.WithOptsProcessor(k8slog.StageFilter, program.Filters),
+			k8slog.WithOptsProcessor(k8slog.StageTransform, program.Setters),
+		)
+	}
+	if flagRedact || len(flagRedactRules) > 0 || len(flagRedactFields) > 0 {
+		redactOpts := []redact.Opts{redact.WithOptsFields(flagRedactFields...)}
+		if flagRedact {
+			redactOpts = append(redactOpts, redact.WithOptsDetectors(redact.Detectors...))
+		}
+		for _, pattern := range flagRedactRules {
+			redactOpts = append(redactOpts, redact.WithOptsPattern(pattern))
+		}
+		redactor, err := redact.New(redactOpts...)
+		if err != nil {
+			return nil, err
+		}
+		// before the pipeline and the recorder, so --record doesn't store the secrets
+		opts = append(opts, k8slog.WithOptsRedactor(redactor))
+	}
+	return append(opts, k8slog.WithOptsJSONFields(flagJSONFields...)), nil
+}
+
+// printLines prints the lines matching the conditions until out is closed or the process is interrupted
+//
+// The lines are also written to the other sinks enabled by the flags.
+func printLines(klog *k8slog.Client, out <-chan k8slog.LogLine, conds []condition, format func(logline *k8slog.LogLine) string) error {
+	fanout, err := newFanOut(func(logline *k8slog.LogLine) bool { return match(logline, conds) }, format)
+	if err != nil {
+		return err
+	}
+
+	// stop on interrupt so the sinks are flushed and closed properly
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+loop:
+	for {
+		select {
+		case logline, ok := <-out:
+			if !ok {
+				break loop
+			}
+			fanout.Write(logline)
+		case <-stop:
+			break loop
+		}
+	}
+	err = fanout.Close()
+	printDropped(klog.Dropped())
+	printDropped(fanout.Dropped())
+	return err
+}
+
+// NeedsCluster returns true if one of the resources isn't a local source
+func NeedsCluster(ress []string) bool {
+	for _, res := range ress {
+		if !k8slog.IsLocal(res) {
+			return true
+		}
+	}
+	return false
+}
+
+// printDropped prints on stderr the number of lines dropped per pod
+func printDropped(dropped map[string]uint64) {
+	pods := make([]string, 0, len(dropped))
+	for pod := range dropped {
+		pods = append(pods, pod)
+	}
+	sort.Strings(pods)
+	for _, pod := range pods {
+		fmt.Fprintf(os.Stderr, "%s: %d lines dropped\n", pod, dropped[pod])
+	}
+}
+
+func formatter(cp *colorpicker.ColorPicker, ress []string) (func(logline *k8slog.LogLine) string, error) {
+	switch flagOutput {
+	case "text":
+	case "json":
+		return func(logline *k8slog.LogLine) string {
+			data, err := json.Marshal(logline)
+			if err != nil {
+				return ""
+			}
+			return string(data) + "\n"
+		}, nil
+	case "template":
+		return templateFormatter()
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", flagOutput)
+	}
+	line, err := lineFormatter(cp, ress)
+	if err != nil {
+		return nil, err
+	}
+	event := k8sEventFormatter()
+	lifecycleStyle := color.New(color.Faint, color.Italic)
+	setColors(lifecycleStyle)
+	return func(logline *k8slog.LogLine) string {
+		if logline.Kind == k8slog.KindK8sEvent {
+			return event(logline)
+		}
+		if !logline.Kind.IsLifecycle() {
+			return line(logline)
+		}
+		text := concat("--- ", logline.Kind.String(), ": ", logline.Line)
+		if logline.Container != "" {
+			text = concat("--- ", logline.Kind.String(), " [", logline.Container, "]: ", logline.Line)
+		}
+		lifecycle := *logline
+		lifecycle.Line = lifecycleStyle.Sprint(text) + "\n"
+		return line(&lifecycle)
+	}, nil
+}
+
+// templateFormatter formats the log lines with the --template go template
+func templateFormatter() (func(logline *k8slog.LogLine) string, error) {
+	tmpl, err := template.New("output").Option("missingkey=zero").Parse(flagTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return func(logline *k8slog.LogLine) string {
+		var buffer bytes.Buffer
+		if logline.PodMeta == nil {
+			// allow the template to use the metadata fields on lines without metadata
+			logline.PodMeta = &k8slog.PodMeta{}
+		}
+		if err := tmpl.Execute(&buffer, logline); err != nil {
+			return concat("template error: ", err.Error(), "\n")
+		}
+		if !strings.HasSuffix(buffer.String(), "\n") {
+			buffer.WriteRune('\n')
+		}
+		return buffer.String()
+	}, nil
+}
+
+// k8sEventFormatter formats kubernetes events with their own prefix, colored by event type
+func k8sEventFormatter() func(logline *k8slog.LogLine) string {
+	warning := color.New(color.FgYellow, color.Bold)
+	normal := color.New(color.FgCyan)
+	setColors(warning, normal)
+	return func(logline *k8slog.LogLine) string {
+		style := normal
+		if logline.Event.Type == "Warning" {
+			style = warning
+		}
+		text := style.Sprint(strings.TrimSuffix(logline.Line, "\n")) + "\n"
+		if !flagPrefix {
+			return text
+		}
+		return concat("[", logline.Namespace, "][event ", logline.Event.Object, "]: ", text)
+	}
+}
+
+func lineFormatter(cp *colorpicker.ColorPicker, ress []string) (func(logline *k8slog.LogLine) string, error) {
+	if !flagPrefix {
+		return func(logline *k8slog.LogLine) string {
+			return logline.Line
+		}, nil
+	}
+	prefix, err := prefixFormatter(cp, ress)
+	if err != nil {
+		return nil, err
+	}
+	return func(logline *k8slog.LogLine) string {
+		return concat(prefix(logline), ": ", logline.Line)
+	}, nil
+}
+
+// colorPicker creates the color picker enabled by --colors, see ApplyConfig for its default
+func colorPicker() (*colorpicker.ColorPicker, error) {
+	switch flagColorBy {
+	case "pod", "resource", "namespace", "container", "cluster":
+	default:
+		return nil, fmt.Errorf("unknown color key: %s", flagColorBy)
+	}
+	cp := colorpicker.New()
+	if len(flagPalette) > 0 {
+		var err error
+		cp, err = colorpicker.NewWithPalette(flagPalette)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cp.SetEnabled(flagColors)
+	return cp, nil
+}
+
+// setColors enables or disables the colors according to --colors, regardless of the terminal
+func setColors(clrs ...*color.Color) {
+	for _, clr := range clrs {
+		if flagColors {
+			clr.EnableColor()
+		} else {
+			clr.DisableColor()
+		}
+	}
+}
+
+// colorKey returns the id used to pick the color of the log line
+func colorKey(logline *k8slog.LogLine) string {
+	switch flagColorBy {
+	case "pod":
+		return logline.Namespace + "/" + logline.Pod
+	case "namespace":
+		return logline.Namespace
+	case "container":
+		return logline.Namespace + "/" + logline.Pod + "/" + logline.Container
+	case "cluster":
+		return cluster
+	}
+	return logline.Namespace + "/" + logline.Type.String() + "/" + logline.Name
+}
+
+func concat(strs ...string) string {
+	var buffer bytes.Buffer
+	for _, str := range strs {
+		buffer.WriteString(str)
+	}
+	return buffer.String()
+}
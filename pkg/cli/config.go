@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+	"k8s.io/client-go/util/homedir"
+)
+
+// envPrefix is the prefix of the environment variables setting the flags (e.g. K8SLOG_MAX_LOG_REQUESTS)
+const envPrefix = "K8SLOG_"
+
+// Config is the content of the configuration file
+//
+//	defaults:
+//	  follow: true
+//	  max-log-requests: 100
+//	aliases:
+//	  checkout: [prod/deploy/checkout-api, prod/sts/checkout-db]
+//	profiles:
+//	  errors:
+//	    json: [timestamp, level, message]
+//	    where: [label.tier=backend]
+//	    output: json
+type Config struct {
+	// Defaults are the default values of the flags, by flag name
+	Defaults map[string]interface{} `yaml:"defaults"`
+	// Aliases are names expanding to a list of resources
+	Aliases map[string][]string `yaml:"aliases"`
+	// Profiles are named sets of flag values, selected with --profile
+	Profiles map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+var (
+	flagConfig  = ""
+	flagProfile = ""
+)
+
+// defaultConfigPath returns $XDG_CONFIG_HOME/k8slog/config.yaml, or ~/.config/k8slog/config.yaml
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := homedir.HomeDir()
+		if home == "" {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "k8slog", "config.yaml")
+}
+
+// loadConfig reads the configuration file, a missing default file is not an error
+func loadConfig() (*Config, error) {
+	path := flagConfig
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	config := &Config{}
+	if path == "" {
+		return config, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return config, nil
+}
+
+// ApplyConfig sets the flags which weren't given on the command line and expands the aliases of the resources.
+//
+// By order of precedence, a flag is set by the command line, then the K8SLOG_* environment variables,
+// then the selected profile, then the defaults of the configuration file.
+// If none of them sets --colors, colors are disabled when stdout is not a terminal or NO_COLOR is set.
+func ApplyConfig(flags *pflag.FlagSet, ress []string) ([]string, error) {
+	var errs []string
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Changed {
+			return
+		}
+		name := envPrefix + strings.ToUpper(strings.Replace(flag.Name, "-", "_", -1))
+		if value, ok := os.LookupEnv(name); ok {
+			if err := flags.Set(flag.Name, value); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+			}
+		}
+	})
+	// the environment may set --config and --profile
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if flagProfile != "" {
+		profile, ok := config.Profiles[flagProfile]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile: %s", flagProfile)
+		}
+		errs = append(errs, setFlags(flags, profile, "profile "+flagProfile)...)
+	}
+	errs = append(errs, setFlags(flags, config.Defaults, "defaults")...)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %s", strings.Join(errs, ", "))
+	}
+	if !flags.Changed("colors") {
+		_, noColor := os.LookupEnv("NO_COLOR")
+		flagColors = !noColor && !color.NoColor
+	}
+	return expandAliases(config.Aliases, ress), nil
+}
+
+// setFlags sets the flags which are not set yet to the given values
+func setFlags(flags *pflag.FlagSet, values map[string]interface{}, source string) []string {
+	var errs []string
+	for name, value := range values {
+		flag := flags.Lookup(name)
+		if flag == nil {
+			errs = append(errs, fmt.Sprintf("%s: unknown flag %s", source, name))
+			continue
+		}
+		if flag.Changed {
+			continue
+		}
+		// lists are set item by item so both slice and array flags accumulate them
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			if err := flags.Set(name, fmt.Sprint(item)); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s: %s", source, name, err))
+			}
+		}
+	}
+	return errs
+}
+
+// expandAliases replaces the aliases by their resources
+func expandAliases(aliases map[string][]string, ress []string) []string {
+	ret := make([]string, 0, len(ress))
+	for _, res := range ress {
+		if expanded, ok := aliases[res]; ok {
+			ret = append(ret, expanded...)
+		} else {
+			ret = append(ret, res)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+const testConfig = `
+defaults:
+  max-log-requests: 10
+  qps: 30
+  follow: true
+aliases:
+  checkout: [prod/deploy/checkout-api, prod/sts/checkout-db]
+profiles:
+  errors:
+    max-log-requests: 20
+    qps: 40
+    json: [level, message]
+`
+
+func TestApplyConfig(t *testing.T) {
+	file, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(testConfig)
+	file.Close()
+
+	os.Setenv("K8SLOG_QPS", "50")
+	defer os.Unsetenv("K8SLOG_QPS")
+	flags := pflag.NewFlagSet("k8slog", pflag.ContinueOnError)
+	AddFlags(flags)
+	err = flags.Parse([]string{"--config", file.Name(), "--profile", "errors", "--burst", "5", "checkout", "mypod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ress, err := ApplyConfig(flags, flags.Args())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"prod/deploy/checkout-api", "prod/sts/checkout-db", "mypod"}; !reflect.DeepEqual(ress, want) {
+		t.Errorf("resources = %v, want %v", ress, want)
+	}
+	// command line, then environment, then profile, then defaults
+	if flagBurst != 5 {
+		t.Errorf("burst = %d, want 5 from the command line", flagBurst)
+	}
+	if flagQPS != 50 {
+		t.Errorf("qps = %v, want 50 from the environment", flagQPS)
+	}
+	if flagMaxRequests != 20 {
+		t.Errorf("max-log-requests = %d, want 20 from the profile", flagMaxRequests)
+	}
+	if !flagFollow {
+		t.Error("follow should be set by the defaults")
+	}
+	if want := []string{"level", "message"}; !reflect.DeepEqual(flagJSONFields, want) {
+		t.Errorf("json = %v, want %v", flagJSONFields, want)
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	file, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("defaults:\n  nope: 1\n")
+	file.Close()
+
+	tests := [][]string{
+		{"--config", file.Name()},
+		{"--config", file.Name() + ".missing"},
+		{"--config", file.Name(), "--profile", "missing"},
+	}
+	for _, args := range tests {
+		flags := pflag.NewFlagSet("k8slog", pflag.ContinueOnError)
+		AddFlags(flags)
+		if err := flags.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ApplyConfig(flags, nil); err == nil {
+			t.Errorf("ApplyConfig with %v should fail", args)
+		}
+	}
+}
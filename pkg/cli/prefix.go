@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/nouney/k8slog/pkg/colorpicker"
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+// defaultPrefixTemplate is the prefix used when no template is given and shortening is disabled
+const defaultPrefixTemplate = "[{{.Namespace}}][{{color .Pod}}]"
+
+var (
+	// ansiCodes matches the color escape sequences, which don't take space on the terminal
+	ansiCodes = regexp.MustCompile("\x1b\\[[0-9;]*m")
+	// podTemplateHash matches a ReplicaSet's pod-template-hash (kubernetes' safe encoding alphabet)
+	podTemplateHash = regexp.MustCompile("^[bcdfghjklmnpqrstvwxz2456789]{5,10}$")
+)
+
+// prefixData are the fields usable in a prefix template
+type prefixData struct {
+	Namespace string
+	Kind      string
+	Resource  string
+	Pod       string
+	ShortPod  string
+	Container string
+	Node      string
+	Cluster   string
+	// MultiContainer is true if several containers of the pod were seen
+	MultiContainer bool
+}
+
+// shortPodName strips the ReplicaSet's hash from the pod name: "api-7d9f8b6c4-x2k9p" becomes "api-x2k9p"
+func shortPodName(pod string) string {
+	chunks := strings.Split(pod, "-")
+	if len(chunks) < 3 || !podTemplateHash.MatchString(chunks[len(chunks)-2]) {
+		return pod
+	}
+	return strings.Join(append(chunks[:len(chunks)-2], chunks[len(chunks)-1]), "-")
+}
+
+// autoPrefixTemplate builds a template without the segments identical for all the resources
+func autoPrefixTemplate(ress []string) string {
+	namespaces := make(map[string]struct{})
+	for _, res := range ress {
+		ns, _, _, err := k8slog.ParseResource(res)
+		if err == nil {
+			namespaces[ns] = struct{}{}
+		}
+	}
+	var buffer bytes.Buffer
+	if len(namespaces) > 1 {
+		buffer.WriteString("[{{.Namespace}}]")
+	}
+	if len(ress) > 1 {
+		buffer.WriteString("[{{.Kind}}/{{.Resource}}]")
+	}
+	buffer.WriteString("[{{color .ShortPod}}]")
+	buffer.WriteString("{{if .MultiContainer}}[{{.Container}}]{{end}}")
+	return buffer.String()
+}
+
+// prefixFormatter returns a function rendering the prefix of the log lines, padded so the lines are aligned
+func prefixFormatter(cp *colorpicker.ColorPicker, ress []string) (func(logline *k8slog.LogLine) string, error) {
+	text := flagPrefixTemplate
+	if text == "" {
+		text = defaultPrefixTemplate
+		if flagPrefixShorten {
+			text = autoPrefixTemplate(ress)
+		}
+	}
+	var current *k8slog.LogLine
+	tmpl, err := template.New("prefix").Funcs(template.FuncMap{
+		"color": func(str string) string {
+			if !flagColors {
+				return str
+			}
+			return cp.Pick(colorKey(current)).Sprint(str)
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	containers := make(map[string]string)
+	multi := make(map[string]bool)
+	width := 0
+	return func(logline *k8slog.LogLine) string {
+		current = logline
+		pod := logline.Namespace + "/" + logline.Pod
+		if logline.Container != "" {
+			if first, ok := containers[pod]; !ok {
+				containers[pod] = logline.Container
+			} else if first != logline.Container {
+				multi[pod] = true
+			}
+		}
+		data := prefixData{
+			Namespace:      logline.Namespace,
+			Kind:           logline.Type.String(),
+			Resource:       logline.Name,
+			Pod:            logline.Pod,
+			ShortPod:       shortPodName(logline.Pod),
+			Container:      logline.Container,
+			Cluster:        cluster,
+			MultiContainer: multi[pod],
+		}
+		if logline.PodMeta != nil {
+			data.Node = logline.Node
+		}
+		var buffer bytes.Buffer
+		if err := tmpl.Execute(&buffer, data); err != nil {
+			return concat("[template error: ", err.Error(), "]")
+		}
+		prefix := buffer.String()
+		if !flagPrefixAlign {
+			return prefix
+		}
+		// pad to the widest prefix seen so far
+		w := utf8.RuneCountInString(ansiCodes.ReplaceAllString(prefix, ""))
+		if w > width {
+			width = w
+		}
+		return prefix + strings.Repeat(" ", width-w)
+	}, nil
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nouney/k8slog/pkg/colorpicker"
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+func TestShortPodName(t *testing.T) {
+	tests := []struct {
+		pod  string
+		want string
+	}{
+		{pod: "api-7d9f8b6c4-x2k9p", want: "api-x2k9p"},
+		{pod: "checkout-api-5c6b7d8f9-abcde", want: "checkout-api-abcde"},
+		// statefulsets, daemonsets and bare pods have no hash
+		{pod: "db-0", want: "db-0"},
+		{pod: "fluentd-x2k9p", want: "fluentd-x2k9p"},
+		{pod: "my-app-server", want: "my-app-server"},
+		// vowels and 0, 1, 3 aren't in the hash alphabet
+		{pod: "api-release-x2k9p", want: "api-release-x2k9p"},
+		{pod: "api-7d9f8b6c0-x2k9p", want: "api-7d9f8b6c0-x2k9p"},
+	}
+	for _, tt := range tests {
+		if got := shortPodName(tt.pod); got != tt.want {
+			t.Errorf("shortPodName(%q) = %q, want %q", tt.pod, got, tt.want)
+		}
+	}
+}
+
+func TestAutoPrefixTemplate(t *testing.T) {
+	tests := []struct {
+		ress []string
+		want string
+	}{
+		{
+			ress: []string{"prod/deploy/api"},
+			want: "[{{color .ShortPod}}]{{if .MultiContainer}}[{{.Container}}]{{end}}",
+		},
+		{
+			ress: []string{"prod/deploy/api", "prod/sts/db"},
+			want: "[{{.Kind}}/{{.Resource}}][{{color .ShortPod}}]{{if .MultiContainer}}[{{.Container}}]{{end}}",
+		},
+		{
+			ress: []string{"prod/deploy/api", "staging/deploy/api"},
+			want: "[{{.Namespace}}][{{.Kind}}/{{.Resource}}][{{color .ShortPod}}]{{if .MultiContainer}}[{{.Container}}]{{end}}",
+		},
+	}
+	for _, tt := range tests {
+		if got := autoPrefixTemplate(tt.ress); got != tt.want {
+			t.Errorf("autoPrefixTemplate(%q) = %q, want %q", tt.ress, got, tt.want)
+		}
+	}
+}
+
+func TestPrefixFormatter(t *testing.T) {
+	defer func(tmpl string, shorten, align, colors bool) {
+		flagPrefixTemplate, flagPrefixShorten, flagPrefixAlign, flagColors = tmpl, shorten, align, colors
+	}(flagPrefixTemplate, flagPrefixShorten, flagPrefixAlign, flagColors)
+	flagPrefixTemplate, flagPrefixShorten, flagPrefixAlign, flagColors = "", true, true, false
+
+	format, err := prefixFormatter(colorpicker.New(), []string{"prod/deploy/api", "prod/sts/db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := func(typ k8slog.ResourceType, name, pod, container string) *k8slog.LogLine {
+		var l k8slog.LogLine
+		l.Namespace = "prod"
+		l.Type = typ
+		l.Name = name
+		l.Pod = pod
+		l.Container = container
+		return &l
+	}
+	got := []string{
+		format(line(k8slog.TypeStatefulSet, "db", "db-0", "postgres")),
+		format(line(k8slog.TypeDeploy, "api", "api-7d9f8b6c4-x2k9p", "app")),
+		// the container is shown once a second container of the pod is seen
+		format(line(k8slog.TypeDeploy, "api", "api-7d9f8b6c4-x2k9p", "sidecar")),
+		format(line(k8slog.TypeStatefulSet, "db", "db-0", "postgres")),
+	}
+	want := []string{
+		"[statefulset/db][db-0]",
+		"[deployment/api][api-x2k9p]",
+		"[deployment/api][api-x2k9p][sidecar]",
+		// padded to the widest prefix seen so far
+		"[statefulset/db][db-0]" + strings.Repeat(" ", 14),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("prefixes %q, want %q", got, want)
+	}
+
+	flagPrefixTemplate, flagPrefixAlign = "{{.Pod}}:{{.Nope}}", false
+	format, err = prefixFormatter(colorpicker.New(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := format(line(k8slog.TypePod, "db-0", "db-0", "")); !strings.HasPrefix(got, "[template error: ") {
+		t.Errorf("prefix %q, want the template error", got)
+	}
+	flagPrefixTemplate = "{{.Pod"
+	if _, err := prefixFormatter(colorpicker.New(), nil); err == nil {
+		t.Error("prefixFormatter succeeded with an invalid template")
+	}
+}
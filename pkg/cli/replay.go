@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+	"github.com/spf13/pflag"
+)
+
+var flagSpeed = float64(0)
+
+// AddReplayFlags adds the flags of the replay command to the flag set
+//
+// The flags retrieving the logs are accepted so the configuration file applies, but they are ignored.
+func AddReplayFlags(flags *pflag.FlagSet) {
+	AddFlags(flags)
+	flags.Float64Var(&flagSpeed, "speed", 0, "replay at the original pace multiplied by this factor, 0 for as fast as possible")
+}
+
+// Replay prints the lines of a session recorded with --record, without accessing the cluster
+func Replay(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	session, err := k8slog.ReadSession(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	conds, err := parseWhere(flagWhere)
+	if err != nil {
+		return err
+	}
+	cp, err := colorPicker()
+	if err != nil {
+		return err
+	}
+	format, err := formatter(cp, session.Resources)
+	if err != nil {
+		return err
+	}
+	opts, err := pipelineOpts()
+	if err != nil {
+		return err
+	}
+	klog := k8slog.New(nil, opts...)
+	// the lifecycle events are dropped by the sinks with --quiet
+	return printLines(klog, klog.Replay(session, flagSpeed), conds, format)
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/nouney/k8slog/pkg/k8s"
+	"github.com/nouney/k8slog/pkg/k8slog"
+	"github.com/nouney/k8slog/pkg/server"
+	"github.com/spf13/pflag"
+)
+
+var (
+	flagListen       = ":8080"
+	flagAllowOrigins = []string{}
+)
+
+// AddServeFlags adds the flags of the serve command to the flag set
+//
+// The output flags are accepted so the configuration file applies, but they are ignored.
+func AddServeFlags(flags *pflag.FlagSet) {
+	AddFlags(flags)
+	flags.StringVar(&flagListen, "listen", ":8080", "address the server listens on")
+	flags.StringSliceVar(&flagAllowOrigins, "allow-origin", nil, "origins of the web pages allowed to stream the logs besides the server's, * for any")
+}
+
+// Serve streams the logs requested over HTTP, see the server package for the endpoints
+func Serve(k8s *k8s.Client) error {
+	// metadata is needed by the filters of the subscribers
+	opts, err := logsOpts(true, true)
+	if err != nil {
+		return err
+	}
+	// one client is shared by all the streams, so is the limit of concurrent log requests
+	srv := server.New(k8slog.New(k8s, opts...), server.WithOptsOrigins(flagAllowOrigins...))
+	log.Printf("listening on %s", flagListen)
+	return http.ListenAndServe(flagListen, srv)
+}
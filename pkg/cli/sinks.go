@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/nouney/k8slog/pkg/filesink"
+	"github.com/nouney/k8slog/pkg/k8slog"
+	"github.com/nouney/k8slog/pkg/loki"
+	"github.com/nouney/k8slog/pkg/otlp"
+	"github.com/nouney/k8slog/pkg/syslog"
+	"github.com/spf13/pflag"
+)
+
+var (
+	flagOutputDir      = ""
+	flagOutputLayout   = filesink.DefaultLayout
+	flagRotateSize     = int64(0)
+	flagRotateInterval = time.Duration(0)
+	flagCompress       = false
+
+	flagLokiURL      = ""
+	flagLokiLabels   = map[string]string{}
+	flagLokiTenant   = ""
+	flagLokiUser     = ""
+	flagLokiPassword = ""
+
+	flagOTLPEndpoint = ""
+	flagOTLPHeaders  = map[string]string{}
+
+	flagSyslog         = ""
+	flagSyslogFacility = "user"
+
+	flagSinkTemplate = ""
+)
+
+// addSinkFlags adds the flags of the outputs other than stdout
+func addSinkFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&flagOutputDir, "output-dir", "", "write the logs of each container to its own file in this directory instead of stdout")
+	flags.StringVar(&flagOutputLayout, "output-layout", filesink.DefaultLayout, "go template of the files' path in --output-dir (fields: .Namespace, .Kind, .Resource, .Pod, .Container)")
+	flags.Int64Var(&flagRotateSize, "rotate-size", 0, "rotate the files of --output-dir bigger than this size in MB, 0 for never")
+	flags.DurationVar(&flagRotateInterval, "rotate-interval", 0, "rotate the files of --output-dir older than this duration, 0 for never")
+	flags.BoolVar(&flagCompress, "compress", false, "gzip the rotated files of --output-dir")
+	flags.StringVar(&flagLokiURL, "loki-url", "", "push the logs to this Loki instead of stdout, e.g. http://localhost:3100")
+	flags.StringToStringVar(&flagLokiLabels, "loki-labels", nil, "static labels of the Loki streams, e.g. job=k8slog,env=loadtest")
+	flags.StringVar(&flagLokiTenant, "loki-tenant", "", "tenant of a multi-tenant Loki (X-Scope-OrgID)")
+	flags.StringVar(&flagLokiUser, "loki-user", "", "user of the Loki basic authentication")
+	flags.StringVar(&flagLokiPassword, "loki-password", "", "password of the Loki basic authentication, prefer K8SLOG_LOKI_PASSWORD")
+	flags.StringVar(&flagOTLPEndpoint, "otlp-endpoint", "", "export the logs to this OTLP/HTTP logs endpoint instead of stdout, e.g. "+otlp.DefaultEndpoint)
+	flags.StringToStringVar(&flagOTLPHeaders, "otlp-headers", nil, "headers of the OTLP requests, e.g. authorization=...")
+	flags.StringVar(&flagSyslog, "syslog", "", "send the logs to this syslog server instead of stdout: udp://host:port, tcp://host:port or tls://host:port")
+	flags.StringVar(&flagSyslogFacility, "syslog-facility", "user", "facility of the syslog messages, e.g. local0")
+	flags.StringVar(&flagSinkTemplate, "sink-template", "", "go template of the message of the log lines sent to the sinks other than stdout, e.g. '{{.Pod}}: {{.Message}}' (default: the message unchanged)")
+}
+
+// sinkFormatter formats the message of the log lines sent to the sinks with the --sink-template go template
+func sinkFormatter() (func(logline *k8slog.LogLine) string, error) {
+	tmpl, err := template.New("sink").Option("missingkey=zero").Parse(flagSinkTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink template: %s", err)
+	}
+	return func(logline *k8slog.LogLine) string {
+		var buffer bytes.Buffer
+		if logline.PodMeta == nil {
+			// allow the template to use the metadata fields on lines without metadata
+			logline.PodMeta = &k8slog.PodMeta{}
+		}
+		if err := tmpl.Execute(&buffer, logline); err != nil {
+			return concat("template error: ", err.Error())
+		}
+		return buffer.String()
+	}, nil
+}
+
+// terminalSink prints the formatted lines on stdout
+type terminalSink struct {
+	format func(logline *k8slog.LogLine) string
+}
+
+func (t terminalSink) Write(l k8slog.LogLine) error {
+	_, err := fmt.Print(t.format(&l))
+	return err
+}
+
+func (t terminalSink) Flush() error {
+	return nil
+}
+
+func (t terminalSink) Close() error {
+	return nil
+}
+
+// newFanOut creates the dispatcher of the lines to stdout and the sinks enabled by the flags.
+//
+// stdout is disabled if another sink is enabled, unless --tee or --summary is set. It's the only sink blocking
+// the others when it's slow, so no line is lost on the terminal. It has its own format, --sink-template formats
+// the messages of the other sinks.
+// The lifecycle events are dropped with --quiet, except for the file sink which needs them for its manifest.
+func newFanOut(filter k8slog.Filter, format func(logline *k8slog.LogLine) string) (*k8slog.FanOut, error) {
+	var sinkOpts []k8slog.SinkOpts
+	if flagSinkTemplate != "" {
+		format, err := sinkFormatter()
+		if err != nil {
+			return nil, err
+		}
+		sinkOpts = append(sinkOpts, k8slog.WithSinkOptsFormat(format))
+	}
+	var sinks []k8slog.Sink
+	var names []string
+	closeAll := func() {
+		for _, s := range sinks {
+			s.Close()
+		}
+	}
+	if flagOutputDir != "" {
+		s, err := filesink.New(
+			flagOutputDir,
+			filesink.WithOptsLayout(flagOutputLayout),
+			filesink.WithOptsRotation(flagRotateSize*1024*1024, flagRotateInterval),
+			filesink.WithOptsCompress(flagCompress),
+		)
+		if err != nil {
+			return nil, err
+		}
+		sinks, names = append(sinks, s), append(names, "files")
+	}
+	if flagLokiURL != "" {
+		s, err := loki.New(
+			flagLokiURL,
+			loki.WithOptsLabels(flagLokiLabels),
+			loki.WithOptsTenant(flagLokiTenant),
+			loki.WithOptsBasicAuth(flagLokiUser, flagLokiPassword),
+		)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		sinks, names = append(sinks, s), append(names, "loki")
+	}
+	if flagOTLPEndpoint != "" {
+		s, err := otlp.New(flagOTLPEndpoint, otlp.WithOptsHeaders(flagOTLPHeaders))
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		sinks, names = append(sinks, s), append(names, "otlp")
+	}
+	if flagSyslog != "" {
+		s, err := syslog.New(flagSyslog, syslog.WithOptsFacility(flagSyslogFacility))
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		sinks, names = append(sinks, s), append(names, "syslog")
+	}
+
+	fanout := k8slog.NewFanOut(func(sink string, err error) {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", sink, err)
+	})
+	quiet := func(logline *k8slog.LogLine) bool {
+		return !(flagQuiet && logline.Kind.IsLifecycle()) && filter(logline)
+	}
+	if len(sinks) == 0 || flagTee || flagSummary {
+		fanout.Add("stdout", stdoutSink(format), k8slog.WithSinkOptsFilter(quiet), k8slog.WithSinkOptsBuffer(0, k8slog.BufferBlock))
+	}
+	for i, s := range sinks {
+		if names[i] == "files" {
+			fanout.Add(names[i], s, append(sinkOpts, k8slog.WithSinkOptsFilter(func(logline *k8slog.LogLine) bool {
+				return logline.Kind.IsLifecycle() || filter(logline)
+			}))...)
+			continue
+		}
+		fanout.Add(names[i], s, append(sinkOpts, k8slog.WithSinkOptsFilter(quiet))...)
+	}
+	return fanout, nil
+}
@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+func TestSinkFormatter(t *testing.T) {
+	defer func(tmpl string) { flagSinkTemplate = tmpl }(flagSinkTemplate)
+	flagSinkTemplate = "{{.Pod}} {{.Node}} {{.Message}}"
+	format, err := sinkFormatter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var l k8slog.LogLine
+	l.Pod = "api-1"
+	l.Line = "2024-01-02T03:04:05Z hello\n"
+	// the metadata fields are empty without --metadata
+	if got := format(&l); got != "api-1  hello" {
+		t.Errorf("format = %q", got)
+	}
+	flagSinkTemplate = "{{.Pod.Nope}}"
+	if format, err = sinkFormatter(); err != nil {
+		t.Fatal(err)
+	}
+	if got := format(&l); !strings.HasPrefix(got, "template error: ") {
+		t.Errorf("format = %q, want the template error", got)
+	}
+	flagSinkTemplate = "{{.Pod"
+	if _, err := sinkFormatter(); err == nil {
+		t.Error("sinkFormatter succeeded with an invalid template")
+	}
+}
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/nouney/k8slog/pkg/drain"
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+const (
+	// summaryMaxPods is the number of pods listed per pattern
+	summaryMaxPods = 5
+	// summaryTimeFormat is the format of the first and last times of the patterns
+	summaryTimeFormat = "2006-01-02 15:04:05"
+)
+
+// pattern is a pattern of the summary: a cluster of lines
+type pattern struct {
+	cluster *drain.Cluster
+	first   time.Time
+	last    time.Time
+	pods    map[string]struct{}
+	sample  string
+}
+
+// jsonPattern is the JSON representation of a pattern
+type jsonPattern struct {
+	Pattern string    `json:"pattern"`
+	Count   uint64    `json:"count"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Pods    []string  `json:"pods"`
+	Sample  string    `json:"sample"`
+}
+
+// summarySink clusters the log lines and prints the patterns when closed, instead of the lines
+type summarySink struct {
+	w        io.Writer
+	miner    *drain.Miner
+	patterns map[int]*pattern
+}
+
+func newSummarySink(w io.Writer) *summarySink {
+	// compare the lines sharing their first word, so "user alice logged in" and "user bob logged in" are joined
+	return &summarySink{w: w, miner: drain.New(drain.WithOptsDepth(1)), patterns: make(map[int]*pattern)}
+}
+
+// Write adds a log line to its pattern, events are ignored
+func (s *summarySink) Write(l k8slog.LogLine) error {
+	if l.Kind != k8slog.KindLog {
+		return nil
+	}
+	// the lines have no time with --timestamp=false, use the time they were received
+	t := l.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	msg := l.Message()
+	cluster := s.miner.Add(msg)
+	p, ok := s.patterns[cluster.ID]
+	if !ok {
+		p = &pattern{cluster: cluster, first: t, pods: make(map[string]struct{}), sample: msg}
+		s.patterns[cluster.ID] = p
+	}
+	if t.Before(p.first) {
+		p.first = t
+	}
+	if t.After(p.last) {
+		p.last = t
+	}
+	p.pods[l.Pod] = struct{}{}
+	return nil
+}
+
+func (s *summarySink) Flush() error {
+	return nil
+}
+
+// Close prints the patterns, the most frequent first
+func (s *summarySink) Close() error {
+	patterns := make([]*pattern, 0, len(s.patterns))
+	for _, p := range s.patterns {
+		patterns = append(patterns, p)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		a, b := patterns[i], patterns[j]
+		if a.cluster.Size != b.cluster.Size {
+			return a.cluster.Size > b.cluster.Size
+		}
+		return a.first.Before(b.first)
+	})
+	if flagOutput == "json" {
+		enc := json.NewEncoder(s.w)
+		enc.SetEscapeHTML(false)
+		for _, p := range patterns {
+			err := enc.Encode(jsonPattern{
+				Pattern: p.cluster.Template(),
+				Count:   p.cluster.Size,
+				First:   p.first,
+				Last:    p.last,
+				Pods:    p.sortedPods(),
+				Sample:  p.sample,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	bold := color.New(color.Bold)
+	faint := color.New(color.Faint)
+	setColors(bold, faint)
+	width := 1
+	if len(patterns) > 0 {
+		width = len(fmt.Sprint(patterns[0].cluster.Size))
+	}
+	indent := strings.Repeat(" ", width+2)
+	for _, p := range patterns {
+		pods := p.sortedPods()
+		list := strings.Join(pods, ", ")
+		if len(pods) > summaryMaxPods {
+			list = fmt.Sprintf("%s (+%d)", strings.Join(pods[:summaryMaxPods], ", "), len(pods)-summaryMaxPods)
+		}
+		_, err := fmt.Fprintf(s.w, "%*d  %s\n%s%s\n%s%s\n",
+			width, p.cluster.Size, bold.Sprint(p.cluster.Template()),
+			indent, faint.Sprintf("first %s  last %s  pods %s", p.first.Format(summaryTimeFormat), p.last.Format(summaryTimeFormat), list),
+			indent, faint.Sprintf("e.g. %s", p.sample))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pattern) sortedPods() []string {
+	pods := make([]string, 0, len(p.pods))
+	for pod := range p.pods {
+		pods = append(pods, pod)
+	}
+	sort.Strings(pods)
+	return pods
+}
+
+// stdoutSink returns the sink of stdout: the summary of the lines with --summary, the lines otherwise
+func stdoutSink(format func(logline *k8slog.LogLine) string) k8slog.Sink {
+	if flagSummary {
+		return newSummarySink(os.Stdout)
+	}
+	return terminalSink{format}
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+func TestSummaryTimes(t *testing.T) {
+	s := newSummarySink(&bytes.Buffer{})
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var l k8slog.LogLine
+	l.Pod = "api-1"
+	l.Line = "user alice logged in\n"
+	l.Time = at
+	s.Write(l)
+	l.Line = "user bob logged in\n"
+	l.Time = at.Add(-time.Minute)
+	s.Write(l)
+	if len(s.patterns) != 1 {
+		t.Fatalf("%d patterns, want 1", len(s.patterns))
+	}
+	for _, p := range s.patterns {
+		if !p.first.Equal(at.Add(-time.Minute)) || !p.last.Equal(at) {
+			t.Errorf("first %v, last %v", p.first, p.last)
+		}
+	}
+	// with --timestamp=false the lines have no time, the time they were received is used
+	s = newSummarySink(&bytes.Buffer{})
+	before := time.Now()
+	l.Time = time.Time{}
+	s.Write(l)
+	s.Write(l)
+	for _, p := range s.patterns {
+		if p.first.Before(before) || p.last.Before(p.first) || time.Since(p.last) > time.Minute {
+			t.Errorf("first %v, last %v, want the current time", p.first, p.last)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+// condition is a --where condition: the field must have the given value
+type condition struct {
+	field string
+	value string
+}
+
+// parseWhere parses the --where conditions (field=value)
+func parseWhere(wheres []string) ([]condition, error) {
+	conds := make([]condition, 0, len(wheres))
+	for _, where := range wheres {
+		chunks := strings.SplitN(where, "=", 2)
+		if len(chunks) != 2 || chunks[0] == "" {
+			return nil, fmt.Errorf("invalid condition, must be field=value: %s", where)
+		}
+		conds = append(conds, condition{chunks[0], chunks[1]})
+	}
+	return conds, nil
+}
+
+// match returns true if the log line matches all the conditions.
+//
+// Lines without metadata, like kubernetes events, always match.
+func match(logline *k8slog.LogLine, conds []condition) bool {
+	if logline.PodMeta == nil {
+		return true
+	}
+	for _, cond := range conds {
+		value, ok := logline.Field(cond.field)
+		if !ok || value != cond.value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+func TestParseWhere(t *testing.T) {
+	conds, err := parseWhere([]string{"label.app=api", "annotation.team=a=b", "node="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []condition{{"label.app", "api"}, {"annotation.team", "a=b"}, {"node", ""}}
+	if len(conds) != len(want) {
+		t.Fatalf("conditions %v, want %v", conds, want)
+	}
+	for i := range want {
+		if conds[i] != want[i] {
+			t.Errorf("condition %d = %v, want %v", i, conds[i], want[i])
+		}
+	}
+	for _, where := range []string{"label.app", "=api"} {
+		if _, err := parseWhere([]string{where}); err == nil {
+			t.Errorf("parseWhere(%q) succeeded", where)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	var l k8slog.LogLine
+	l.Namespace = "prod"
+	l.Pod = "api-1"
+	l.Container = "app"
+	l.PodMeta = &k8slog.PodMeta{
+		Labels:      map[string]string{"app": "api", "tier": "backend"},
+		Annotations: map[string]string{"team": "payments"},
+		Node:        "node-1",
+		Owner:       "replicaset/api-5d9c",
+	}
+	tests := []struct {
+		wheres []string
+		want   bool
+	}{
+		{wheres: nil, want: true},
+		{wheres: []string{"label.app=api"}, want: true},
+		{wheres: []string{"label.app=web"}, want: false},
+		{wheres: []string{"label.missing="}, want: false},
+		{wheres: []string{"annotation.team=payments"}, want: true},
+		{wheres: []string{"annotation.team=search"}, want: false},
+		{wheres: []string{"node=node-1", "owner=replicaset/api-5d9c"}, want: true},
+		{wheres: []string{"namespace=prod", "container=app"}, want: true},
+		// all the conditions must match
+		{wheres: []string{"label.app=api", "label.tier=frontend"}, want: false},
+		{wheres: []string{"unknown=x"}, want: false},
+	}
+	for _, tt := range tests {
+		conds, err := parseWhere(tt.wheres)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := match(&l, conds); got != tt.want {
+			t.Errorf("match(%q) = %t, want %t", tt.wheres, got, tt.want)
+		}
+	}
+}
+
+func TestMatchWithoutMetadata(t *testing.T) {
+	// kubernetes events and lines of local sources have no metadata, the server's filter relies on them matching
+	var l k8slog.LogLine
+	l.Kind = k8slog.KindK8sEvent
+	l.Line = "Back-off restarting failed container"
+	conds, err := parseWhere([]string{"label.app=web", "node=node-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match(&l, conds) {
+		t.Error("a line without metadata doesn't match")
+	}
+}
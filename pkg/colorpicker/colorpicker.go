@@ -1,84 +1,154 @@
 package colorpicker
 
 import (
-	"math/rand"
-	"time"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
 
 	"github.com/fatih/color"
 )
 
-type key struct {
-	fg    color.Attribute
-	style color.Attribute
+var fgColors = []color.Attribute{
+	color.FgRed,
+	color.FgGreen,
+	color.FgYellow,
+	color.FgBlue,
+	color.FgMagenta,
+	color.FgCyan,
+	color.FgWhite,
+	color.FgHiRed,
+	color.FgHiGreen,
+	color.FgHiYellow,
+	color.FgHiBlue,
+	color.FgHiMagenta,
+	color.FgHiCyan,
+	color.FgHiWhite,
 }
 
-// ColorPicker allows you to assign a unique random color to an id.
+var styles = []color.Attribute{
+	color.Bold,
+	color.Italic,
+	color.Underline,
+	color.ReverseVideo,
+}
+
+// names are the names usable in a palette's color specification
+var names = map[string]color.Attribute{
+	"black":      color.FgBlack,
+	"red":        color.FgRed,
+	"green":      color.FgGreen,
+	"yellow":     color.FgYellow,
+	"blue":       color.FgBlue,
+	"magenta":    color.FgMagenta,
+	"cyan":       color.FgCyan,
+	"white":      color.FgWhite,
+	"hi-black":   color.FgHiBlack,
+	"hi-red":     color.FgHiRed,
+	"hi-green":   color.FgHiGreen,
+	"hi-yellow":  color.FgHiYellow,
+	"hi-blue":    color.FgHiBlue,
+	"hi-magenta": color.FgHiMagenta,
+	"hi-cyan":    color.FgHiCyan,
+	"hi-white":   color.FgHiWhite,
+	"bold":       color.Bold,
+	"faint":      color.Faint,
+	"italic":     color.Italic,
+	"underline":  color.Underline,
+	"reverse":    color.ReverseVideo,
+}
+
+// ColorPicker allows you to assign a stable color to an id.
+//
+// The color of an id is chosen by hashing it, so the same id gets the same color on every run,
+// whatever the other ids. Two ids may share a color.
 type ColorPicker struct {
-	fgColors []color.Attribute
-	styles   []color.Attribute
-	cache    map[key]struct{}
-	colors   map[string]*color.Color
-	src      rand.Source
+	palette []*color.Color
 }
 
-// New creates a new ColorPicker.
+// New creates a new ColorPicker with the default palette.
 func New() *ColorPicker {
-	return &ColorPicker{
-		fgColors: []color.Attribute{
-			color.FgRed,
-			color.FgGreen,
-			color.FgYellow,
-			color.FgBlue,
-			color.FgMagenta,
-			color.FgCyan,
-			color.FgWhite,
-			color.FgHiRed,
-			color.FgHiGreen,
-			color.FgHiYellow,
-			color.FgHiBlue,
-			color.FgHiMagenta,
-			color.FgHiCyan,
-			color.FgHiWhite,
-		},
-		styles: []color.Attribute{
-			color.Bold,
-			color.Italic,
-			color.Underline,
-			color.ReverseVideo,
-		},
-		cache:  make(map[key]struct{}),
-		colors: make(map[string]*color.Color),
-		src:    rand.NewSource(time.Now().UnixNano()),
+	palette := make([][]color.Attribute, 0, len(fgColors)*len(styles))
+	for _, style := range styles {
+		for _, fg := range fgColors {
+			palette = append(palette, []color.Attribute{fg, style})
+		}
 	}
+	return newColorPicker(palette)
 }
 
-// Pick picks a color for the id, generating a new random color if necessary.
-func (cp *ColorPicker) Pick(id string) *color.Color {
-	clr := cp.colors[id]
-	if clr != nil {
-		return clr
+// NewWithPalette creates a new ColorPicker with the given palette.
+//
+// A color is a list of attributes separated by "+", an attribute being:
+//	- a name: red, hi-blue, bold, italic, underline, reverse, ...
+//	- a 256-color code: 0 to 255
+//	- a truecolor: #rrggbb
+// Examples: "red", "bold+208", "underline+#ff8800"
+func NewWithPalette(specs []string) (*ColorPicker, error) {
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("empty palette")
 	}
-	var fg, style color.Attribute
-	for {
-		fg = cp.randomFgColor()
-		style = cp.randomStyle()
-		_, ok := cp.cache[key{fg, style}]
-		if !ok {
-			break
+	palette := make([][]color.Attribute, 0, len(specs))
+	for _, spec := range specs {
+		attrs, err := parseColor(spec)
+		if err != nil {
+			return nil, err
 		}
+		palette = append(palette, attrs)
 	}
-	clr = color.New(fg, style)
-	cp.colors[id] = clr
-	cp.cache[key{fg, style}] = struct{}{}
-	return clr
+	return newColorPicker(palette), nil
 }
 
-func (cp ColorPicker) randomFgColor() color.Attribute {
-	i := cp.src.Int63() % int64(len(cp.fgColors))
-	return cp.fgColors[i]
+func newColorPicker(palette [][]color.Attribute) *ColorPicker {
+	cp := &ColorPicker{
+		palette: make([]*color.Color, len(palette)),
+	}
+	for i, attrs := range palette {
+		cp.palette[i] = color.New(attrs...)
+	}
+	return cp
 }
 
-func (cp ColorPicker) randomStyle() color.Attribute {
-	i := cp.src.Int63() % int64(len(cp.styles))
-	return cp.styles[i]
+// SetEnabled enables or disables the colors, regardless of the terminal.
+func (cp *ColorPicker) SetEnabled(value bool) {
+	for _, clr := range cp.palette {
+		if value {
+			clr.EnableColor()
+		} else {
+			clr.DisableColor()
+		}
+	}
+}
+
+// Pick picks a color for the id.
+func (cp *ColorPicker) Pick(id string) *color.Color {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return cp.palette[h.Sum32()%uint32(len(cp.palette))]
+}
+
+// parseColor parses a color specification
+func parseColor(spec string) ([]color.Attribute, error) {
+	var attrs []color.Attribute
+	for _, token := range strings.Split(spec, "+") {
+		token = strings.ToLower(strings.TrimSpace(token))
+		if attr, ok := names[token]; ok {
+			attrs = append(attrs, attr)
+			continue
+		}
+		if strings.HasPrefix(token, "#") && len(token) == 7 {
+			rgb, err := strconv.ParseUint(token[1:], 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid color %s: %s", spec, err)
+			}
+			attrs = append(attrs, 38, 2, color.Attribute(rgb>>16&0xff), color.Attribute(rgb>>8&0xff), color.Attribute(rgb&0xff))
+			continue
+		}
+		code, err := strconv.Atoi(token)
+		if err != nil || code < 0 || code > 255 {
+			return nil, fmt.Errorf("invalid color %s: unknown attribute %s", spec, token)
+		}
+		attrs = append(attrs, 38, 5, color.Attribute(code))
+	}
+	return attrs, nil
 }
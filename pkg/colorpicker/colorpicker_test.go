@@ -0,0 +1,76 @@
+package colorpicker
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestPickIsStable(t *testing.T) {
+	ids := []string{"prod/api-1", "prod/api-2", "prod/db-0", "staging/api-1", "staging/worker-7"}
+	first := New()
+	picked := make(map[string]*color.Color)
+	for _, id := range ids {
+		picked[id] = first.Pick(id)
+	}
+	// the colors don't depend on the order in which the ids are picked
+	second := New()
+	for i := len(ids) - 1; i >= 0; i-- {
+		if clr := second.Pick(ids[i]); !clr.Equals(picked[ids[i]]) {
+			t.Errorf("Pick(%q) depends on the order of the ids", ids[i])
+		}
+	}
+	if clr := first.Pick(ids[0]); clr != picked[ids[0]] {
+		t.Errorf("Pick(%q) changed", ids[0])
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		spec  string
+		attrs []color.Attribute
+		err   bool
+	}{
+		{spec: "red", attrs: []color.Attribute{color.FgRed}},
+		{spec: "Hi-Blue + bold", attrs: []color.Attribute{color.FgHiBlue, color.Bold}},
+		{spec: "bold+208", attrs: []color.Attribute{color.Bold, 38, 5, 208}},
+		{spec: "underline+#ff8800", attrs: []color.Attribute{color.Underline, 38, 2, 0xff, 0x88, 0x00}},
+		{spec: "256", err: true},
+		{spec: "#ff88", err: true},
+		{spec: "#gg8800", err: true},
+		{spec: "pink", err: true},
+	}
+	for _, tt := range tests {
+		attrs, err := parseColor(tt.spec)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseColor(%q) = %v, want an error", tt.spec, attrs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseColor(%q): %s", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(attrs, tt.attrs) {
+			t.Errorf("parseColor(%q) = %v, want %v", tt.spec, attrs, tt.attrs)
+		}
+	}
+}
+
+func TestNewWithPalette(t *testing.T) {
+	if _, err := NewWithPalette(nil); err == nil {
+		t.Error("NewWithPalette(nil) should fail")
+	}
+	if _, err := NewWithPalette([]string{"red", "nope"}); err == nil {
+		t.Error("NewWithPalette with an invalid color should fail")
+	}
+	cp, err := NewWithPalette([]string{"red"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cp.Pick("a").Equals(cp.Pick("b")) {
+		t.Error("a palette of one color should give it to every id")
+	}
+}
@@ -0,0 +1,196 @@
+// Package drain clusters log messages into templates with the Drain algorithm.
+//
+// See "Drain: An Online Log Parsing Approach with Fixed Depth Tree" (He et al., ICWS 2017).
+package drain
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Wildcard replaces the tokens which differ between the messages of a cluster
+const Wildcard = "<*>"
+
+const (
+	defaultDepth       = 2
+	defaultSimilarity  = 0.4
+	defaultMaxChildren = 100
+)
+
+// masks replace the variable parts of the messages before clustering, in this order
+var masks = []struct {
+	pattern *regexp.Regexp
+	mask    string
+}{
+	{regexp.MustCompile(`\b[0-9a-fA-F]{8}(?:-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`\b(?:0x)?[0-9a-fA-F]*\d[0-9a-fA-F]*\b`), "<num>"},
+}
+
+// Cluster is a group of similar messages
+type Cluster struct {
+	// ID identifies the cluster, starting at 1
+	ID int
+	// Tokens are the words of the template, Wildcard where the messages differ
+	Tokens []string
+	// Size is the number of messages of the cluster
+	Size uint64
+}
+
+// Template returns the template of the messages, e.g. "user <*> logged in from <ip>"
+func (c *Cluster) Template() string {
+	return strings.Join(c.Tokens, " ")
+}
+
+// node is a node of the parse tree: the first level is the number of tokens, the next ones the first tokens
+type node struct {
+	children map[string]*node
+	clusters []*Cluster
+}
+
+func newNode() *node {
+	return &node{children: make(map[string]*node)}
+}
+
+// Miner clusters the messages as they are added
+//
+// A Miner is not safe for concurrent use.
+type Miner struct {
+	depth       int
+	similarity  float64
+	maxChildren int
+	root        *node
+	clusters    []*Cluster
+}
+
+// Opts is an option used to configure Miner
+type Opts func(m *Miner)
+
+// WithOptsDepth configures the number of first tokens messages must share to be compared (default: 2)
+func WithOptsDepth(depth int) Opts {
+	return func(m *Miner) {
+		m.depth = depth
+	}
+}
+
+// WithOptsSimilarity configures the minimum ratio of identical tokens to join a cluster (default: 0.4)
+func WithOptsSimilarity(similarity float64) Opts {
+	return func(m *Miner) {
+		m.similarity = similarity
+	}
+}
+
+// WithOptsMaxChildren configures the maximum number of children of a node of the parse tree (default: 100).
+//
+// Tokens exceeding the limit share a wildcard node, which bounds the memory used by messages starting with IDs.
+func WithOptsMaxChildren(max int) Opts {
+	return func(m *Miner) {
+		m.maxChildren = max
+	}
+}
+
+// New creates a new Miner
+func New(opts ...Opts) *Miner {
+	m := &Miner{
+		depth:       defaultDepth,
+		similarity:  defaultSimilarity,
+		maxChildren: defaultMaxChildren,
+		root:        newNode(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Add adds a message to its cluster, created if none is similar enough, and returns the cluster
+//
+// The template of the cluster is updated, its ID doesn't change.
+func (m *Miner) Add(msg string) *Cluster {
+	tokens := Tokenize(msg)
+	leaf := m.leaf(tokens)
+	var best *Cluster
+	bestSim, bestWildcards := -1.0, -1
+	for _, c := range leaf.clusters {
+		sim, wildcards := similarity(c.Tokens, tokens)
+		if sim > bestSim || (sim == bestSim && wildcards > bestWildcards) {
+			best, bestSim, bestWildcards = c, sim, wildcards
+		}
+	}
+	if best != nil && bestSim >= m.similarity {
+		for i, token := range tokens {
+			if best.Tokens[i] != token {
+				best.Tokens[i] = Wildcard
+			}
+		}
+		best.Size++
+		return best
+	}
+	c := &Cluster{ID: len(m.clusters) + 1, Tokens: tokens, Size: 1}
+	leaf.clusters = append(leaf.clusters, c)
+	m.clusters = append(m.clusters, c)
+	return c
+}
+
+// Clusters returns the clusters, in the order they were created
+func (m *Miner) Clusters() []*Cluster {
+	return m.clusters
+}
+
+// leaf returns the node of the messages having the same number of tokens and first tokens, creating it if needed
+func (m *Miner) leaf(tokens []string) *node {
+	n := m.child(m.root, strconv.Itoa(len(tokens)), false)
+	for i := 0; i < m.depth && i < len(tokens); i++ {
+		n = m.child(n, tokens[i], true)
+	}
+	return n
+}
+
+// child returns the child of the node for the key, or the wildcard child if the key is variable or
+// the node is full
+func (m *Miner) child(n *node, key string, limit bool) *node {
+	if limit && strings.HasPrefix(key, "<") && strings.HasSuffix(key, ">") {
+		key = Wildcard
+	}
+	if child, ok := n.children[key]; ok {
+		return child
+	}
+	if limit && len(n.children) >= m.maxChildren {
+		key = Wildcard
+		if child, ok := n.children[key]; ok {
+			return child
+		}
+	}
+	child := newNode()
+	n.children[key] = child
+	return child
+}
+
+// Tokenize masks the variable parts of the message (UUIDs, IPs, numbers and hexadecimal IDs) and splits it in words
+func Tokenize(msg string) []string {
+	for _, m := range masks {
+		msg = m.pattern.ReplaceAllString(msg, m.mask)
+	}
+	return strings.Fields(msg)
+}
+
+// similarity returns the ratio of the template's tokens identical to the message's and the number of wildcards.
+//
+// Both must have the same number of tokens.
+func similarity(template, tokens []string) (float64, int) {
+	if len(tokens) == 0 {
+		return 1, 0
+	}
+	same, wildcards := 0, 0
+	for i, token := range template {
+		if token == Wildcard {
+			wildcards++
+			continue
+		}
+		if token == tokens[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(tokens)), wildcards
+}
@@ -0,0 +1,143 @@
+package drain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want []string
+	}{
+		{msg: "user alice logged in", want: []string{"user", "alice", "logged", "in"}},
+		{msg: "request 123e4567-e89b-12d3-a456-426614174000 done", want: []string{"request", "<uuid>", "done"}},
+		{msg: "connected to 10.0.0.1:8080 and 192.168.1.20", want: []string{"connected", "to", "<ip>", "and", "<ip>"}},
+		{msg: "took 42 ms, commit 0xdeadbeef1 at 3f2a", want: []string{"took", "<num>", "ms,", "commit", "<num>", "at", "<num>"}},
+		// words without digits aren't numbers, even if they are hexadecimal
+		{msg: "added beef to cafe", want: []string{"added", "beef", "to", "cafe"}},
+		{msg: "  ", want: []string{}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.msg); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		template  []string
+		tokens    []string
+		sim       float64
+		wildcards int
+	}{
+		{template: []string{"a", "b", "c", "d"}, tokens: []string{"a", "b", "c", "d"}, sim: 1},
+		{template: []string{"a", "b", "c", "d"}, tokens: []string{"a", "x", "c", "y"}, sim: 0.5},
+		{template: []string{"a", Wildcard, "c", "d"}, tokens: []string{"a", "x", "c", "y"}, sim: 0.5, wildcards: 1},
+		{template: []string{}, tokens: []string{}, sim: 1},
+	}
+	for _, tt := range tests {
+		sim, wildcards := similarity(tt.template, tt.tokens)
+		if sim != tt.sim || wildcards != tt.wildcards {
+			t.Errorf("similarity(%q, %q) = %v, %d, want %v, %d", tt.template, tt.tokens, sim, wildcards, tt.sim, tt.wildcards)
+		}
+	}
+}
+
+// templates returns the templates of the clusters, in the order they were created
+func templates(m *Miner) []string {
+	var out []string
+	for _, c := range m.Clusters() {
+		out = append(out, c.Template())
+	}
+	return out
+}
+
+func TestMiner(t *testing.T) {
+	msgs := []string{
+		"user alice logged in from 10.0.0.1",
+		"user bob logged in from 10.0.0.2",
+		"user bob logged out",
+		"user carol logged in from 10.0.0.3",
+		"cache miss for key 42",
+	}
+	tests := []struct {
+		name string
+		opts []Opts
+		want []string
+	}{
+		{
+			// the second tokens differ, so the messages aren't compared
+			name: "default",
+			want: []string{
+				"user alice logged in from <ip>", "user bob logged in from <ip>", "user bob logged out",
+				"user carol logged in from <ip>", "cache miss for key <num>",
+			},
+		},
+		{
+			name: "depth 1",
+			opts: []Opts{WithOptsDepth(1)},
+			want: []string{"user <*> logged in from <ip>", "user bob logged out", "cache miss for key <num>"},
+		},
+		{
+			// 5 of the 6 tokens are identical, below the threshold
+			name: "similarity",
+			opts: []Opts{WithOptsDepth(1), WithOptsSimilarity(0.9)},
+			want: []string{
+				"user alice logged in from <ip>", "user bob logged in from <ip>", "user bob logged out",
+				"user carol logged in from <ip>", "cache miss for key <num>",
+			},
+		},
+	}
+	for _, tt := range tests {
+		m := New(tt.opts...)
+		for _, msg := range msgs {
+			m.Add(msg)
+		}
+		if got := templates(m); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: templates %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMinerClusters(t *testing.T) {
+	m := New(WithOptsDepth(1))
+	first := m.Add("job 1 failed: timeout")
+	second := m.Add("job 2 failed: refused")
+	if first != second || first.ID != 1 || first.Size != 2 {
+		t.Fatalf("clusters %+v and %+v, want the same cluster 1 of size 2", first, second)
+	}
+	if got := first.Template(); got != "job <num> failed: <*>" {
+		t.Errorf("template %q", got)
+	}
+	// the template keeps its wildcards once a message matches it
+	if c := m.Add("job 3 failed: timeout"); c.ID != 1 || c.Template() != "job <num> failed: <*>" {
+		t.Errorf("cluster %d, template %q", c.ID, c.Template())
+	}
+	if c := m.Add("job 4 done"); c.ID != 2 {
+		t.Errorf("a message of another length joined the cluster %d", c.ID)
+	}
+}
+
+func TestMinerWildcardChild(t *testing.T) {
+	m := New(WithOptsDepth(1), WithOptsMaxChildren(2))
+	for _, msg := range []string{"alpha started", "beta started", "gamma started", "delta started"} {
+		m.Add(msg)
+	}
+	// gamma and delta exceed the children of the node, they share the wildcard child
+	want := []string{"alpha started", "beta started", "<*> started"}
+	if got := templates(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("templates %q, want %q", got, want)
+	}
+	length := m.root.children["2"]
+	if len(length.children) != 3 || length.children[Wildcard] == nil {
+		t.Errorf("children %v, want alpha, beta and the wildcard", length.children)
+	}
+	// the masked tokens always go to the wildcard child
+	m = New(WithOptsDepth(1))
+	m.Add("10.0.0.1 connected")
+	if _, ok := m.root.children["2"].children[Wildcard]; !ok {
+		t.Errorf("children %v, want the wildcard", m.root.children["2"].children)
+	}
+}
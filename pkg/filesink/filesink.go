@@ -0,0 +1,347 @@
+// Package filesink writes the log lines of each pod's container to its own file
+package filesink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultLayout is the default path of the files, relative to the output directory
+	DefaultLayout = "{{.Namespace}}/{{.Resource}}/{{.Pod}}/{{.Container}}.log"
+	// ManifestFile is the name of the manifest, in the output directory
+	ManifestFile = "manifest.json"
+)
+
+// Sink writes the log lines to files, one per container
+//
+// A Sink is not safe for concurrent use.
+type Sink struct {
+	dir      string
+	layout   *template.Template
+	maxSize  int64
+	maxAge   time.Duration
+	compress bool
+	streams  map[string]*stream
+}
+
+// Opts is an option used to configure Sink
+type Opts func(s *Sink) error
+
+// WithOptsLayout configures the path of the files, relative to the output directory (default: DefaultLayout).
+//
+// The layout is a go template with the fields .Namespace, .Kind, .Resource, .Pod and .Container.
+func WithOptsLayout(layout string) Opts {
+	return func(s *Sink) error {
+		tmpl, err := template.New("layout").Parse(layout)
+		if err != nil {
+			return errors.Wrap(err, "layout")
+		}
+		s.layout = tmpl
+		return nil
+	}
+}
+
+// WithOptsRotation configures when the files are rotated (default: never).
+//
+// A file is rotated when it's bigger than maxSize bytes or older than maxAge. 0 disables the limit.
+func WithOptsRotation(maxSize int64, maxAge time.Duration) Opts {
+	return func(s *Sink) error {
+		s.maxSize = maxSize
+		s.maxAge = maxAge
+		return nil
+	}
+}
+
+// WithOptsCompress enables the compression of the rotated files with gzip (default: false)
+func WithOptsCompress(value bool) Opts {
+	return func(s *Sink) error {
+		s.compress = value
+		return nil
+	}
+}
+
+// New creates a new Sink writing in the given directory
+func New(dir string, opts ...Opts) (*Sink, error) {
+	s := &Sink{
+		dir:     dir,
+		streams: make(map[string]*stream),
+	}
+	if err := WithOptsLayout(DefaultLayout)(s); err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "output directory")
+	}
+	return s, nil
+}
+
+// layoutData are the fields usable in the layout
+type layoutData struct {
+	Namespace string
+	Kind      string
+	Resource  string
+	Pod       string
+	Container string
+}
+
+// stream is the file of a container
+type stream struct {
+	entry  *Entry
+	path   string
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// Entry is a captured container in the manifest
+type Entry struct {
+	Namespace string    `json:"namespace"`
+	Resource  string    `json:"resource"`
+	Pod       string    `json:"pod"`
+	Container string    `json:"container"`
+	Files     []string  `json:"files"`
+	Lines     uint64    `json:"lines"`
+	First     time.Time `json:"first"`
+	Last      time.Time `json:"last"`
+	Deleted   bool      `json:"deleted,omitempty"`
+}
+
+// Write writes a log line to the file of its container
+//
+// Lifecycle events and kubernetes events aren't written, a deleted pod is recorded in the manifest.
+func (s *Sink) Write(l k8slog.LogLine) error {
+	if l.Kind == k8slog.KindPodDeleted {
+		for _, st := range s.streams {
+			if st.entry.Namespace == l.Namespace && st.entry.Pod == l.Pod {
+				st.entry.Deleted = true
+			}
+		}
+		return s.writeManifest()
+	}
+	if l.Kind != k8slog.KindLog {
+		return nil
+	}
+	st, err := s.stream(&l)
+	if err != nil {
+		return err
+	}
+	if s.shouldRotate(st) {
+		if err := s.rotate(st); err != nil {
+			return err
+		}
+	}
+	line := l.Line
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	n, err := io.WriteString(st.file, line)
+	st.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "write")
+	}
+	if st.entry.Lines == 0 {
+		st.entry.First = l.Time
+	}
+	st.entry.Lines++
+	st.entry.Last = l.Time
+	return nil
+}
+
+// Flush writes the manifest, the lines are written by Write
+func (s *Sink) Flush() error {
+	return s.writeManifest()
+}
+
+// Close closes the files and writes the manifest
+func (s *Sink) Close() error {
+	var err error
+	for _, st := range s.streams {
+		if e := st.file.Close(); e != nil && err == nil {
+			err = errors.Wrap(e, "close")
+		}
+	}
+	if e := s.writeManifest(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// stream returns the stream of the line's container, opening its file if needed
+func (s *Sink) stream(l *k8slog.LogLine) (*stream, error) {
+	key := l.Namespace + "/" + l.Pod + "/" + l.Container
+	if st, ok := s.streams[key]; ok {
+		return st, nil
+	}
+	var buffer bytes.Buffer
+	err := s.layout.Execute(&buffer, layoutData{
+		Namespace: l.Namespace,
+		Kind:      l.Type.String(),
+		Resource:  l.Name,
+		Pod:       l.Pod,
+		Container: l.Container,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "layout")
+	}
+	st := &stream{
+		entry: &Entry{
+			Namespace: l.Namespace,
+			Resource:  l.Type.String() + "/" + l.Name,
+			Pod:       l.Pod,
+			Container: l.Container,
+		},
+		path: filepath.Join(s.dir, filepath.FromSlash(buffer.String())),
+	}
+	// the fields come from the cluster, e.g. a ".." namespace or pod must not escape the directory
+	rel, err := filepath.Rel(s.dir, st.path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || rel == ManifestFile {
+		return nil, errors.Errorf("layout: %s is outside of the output directory", buffer.String())
+	}
+	if err := s.open(st); err != nil {
+		return nil, err
+	}
+	s.streams[key] = st
+	// record the new container right away, in case we're killed
+	return st, s.writeManifest()
+}
+
+// open opens the stream's file, appending if it already exists
+func (s *Sink) open(st *stream) error {
+	if err := os.MkdirAll(filepath.Dir(st.path), 0755); err != nil {
+		return errors.Wrap(err, "open")
+	}
+	file, err := os.OpenFile(st.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "open")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrap(err, "open")
+	}
+	st.file = file
+	st.size = info.Size()
+	st.opened = time.Now()
+	st.entry.Files = appendFile(st.entry.Files, s.rel(st.path))
+	return nil
+}
+
+func (s *Sink) shouldRotate(st *stream) bool {
+	if s.maxSize > 0 && st.size >= s.maxSize {
+		return true
+	}
+	return s.maxAge > 0 && time.Since(st.opened) >= s.maxAge
+}
+
+// rotate renames the current file with the rotation time ("app.log" becomes "app-20060102T150405.log"),
+// compresses it if enabled and opens a new file
+func (s *Sink) rotate(st *stream) error {
+	if err := st.file.Close(); err != nil {
+		return errors.Wrap(err, "rotate")
+	}
+	ext := filepath.Ext(st.path)
+	rotated := strings.TrimSuffix(st.path, ext) + "-" + time.Now().Format("20060102T150405.000") + ext
+	if err := os.Rename(st.path, rotated); err != nil {
+		return errors.Wrap(err, "rotate")
+	}
+	if s.compress {
+		if err := compress(rotated); err != nil {
+			return err
+		}
+		rotated += ".gz"
+	}
+	files := st.entry.Files[:len(st.entry.Files)-1]
+	st.entry.Files = append(files, s.rel(rotated))
+	if err := s.open(st); err != nil {
+		return err
+	}
+	return s.writeManifest()
+}
+
+// compress gzips the file and removes it
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "compress")
+	}
+	defer in.Close()
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return errors.Wrap(err, "compress")
+	}
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if e := gz.Close(); err == nil {
+		err = e
+	}
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return errors.Wrap(err, "compress")
+	}
+	return os.Remove(path)
+}
+
+// writeManifest writes the list of the captured containers, sorted by namespace, pod and container
+func (s *Sink) writeManifest() error {
+	entries := make([]*Entry, 0, len(s.streams))
+	for _, st := range s.streams {
+		entries = append(entries, st.entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Pod != b.Pod {
+			return a.Pod < b.Pod
+		}
+		return a.Container < b.Container
+	})
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "manifest")
+	}
+	// write then rename so the manifest is never truncated
+	path := filepath.Join(s.dir, ManifestFile)
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return errors.Wrap(err, "manifest")
+	}
+	return errors.Wrap(os.Rename(path+".tmp", path), "manifest")
+}
+
+// rel returns the path relative to the output directory
+func (s *Sink) rel(path string) string {
+	if rel, err := filepath.Rel(s.dir, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// appendFile appends the file to the list unless it's already the last one
+func appendFile(files []string, file string) []string {
+	if len(files) > 0 && files[len(files)-1] == file {
+		return files
+	}
+	return append(files, file)
+}
@@ -0,0 +1,160 @@
+package filesink
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+func logLine(ns, pod, container, msg string) k8slog.LogLine {
+	var l k8slog.LogLine
+	l.Namespace = ns
+	l.Type = k8slog.TypeDeploy
+	l.Name = "api"
+	l.Kind = k8slog.KindLog
+	l.Time = time.Now()
+	l.Pod = pod
+	l.Container = container
+	l.Line = msg
+	return l
+}
+
+func readManifest(t *testing.T, dir string) []Entry {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []k8slog.LogLine{
+		logLine("prod", "api-1", "app", "first"),
+		logLine("prod", "api-1", "app", "second\n"),
+		logLine("prod", "api-2", "app", "other"),
+	} {
+		if err := s.Write(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted := logLine("prod", "api-2", "", "pod deleted")
+	deleted.Kind = k8slog.KindPodDeleted
+	if err := s.Write(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "prod", "api", "api-1", "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first\nsecond\n" {
+		t.Errorf("api-1 file = %q", data)
+	}
+	entries := readManifest(t, dir)
+	if len(entries) != 2 {
+		t.Fatalf("manifest has %d entries, want 2", len(entries))
+	}
+	if entries[0].Pod != "api-1" || entries[0].Lines != 2 || entries[0].Deleted {
+		t.Errorf("api-1 entry = %+v", entries[0])
+	}
+	if entries[1].Pod != "api-2" || entries[1].Lines != 1 || !entries[1].Deleted {
+		t.Errorf("api-2 entry = %+v", entries[1])
+	}
+	if entries[0].Resource != "deployment/api" || entries[0].Files[0] != "prod/api/api-1/app.log" {
+		t.Errorf("api-1 entry = %+v", entries[0])
+	}
+}
+
+func TestLayoutOutsideOfDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		layout string
+		pod    string
+		err    bool
+	}{
+		{layout: DefaultLayout, pod: "api-1"},
+		{layout: "{{.Pod}}/../{{.Container}}.log", pod: "api-1"},
+		{layout: "/{{.Pod}}.log", pod: "api-1"},
+		{layout: "../{{.Pod}}.log", pod: "api-1", err: true},
+		{layout: "{{.Pod}}/../../{{.Container}}.log", pod: "api-1", err: true},
+		{layout: "{{.Pod}}", pod: "..", err: true},
+		{layout: "{{.Pod}}", pod: ".", err: true},
+		{layout: "{{.Pod}}", pod: ManifestFile, err: true},
+	}
+	for _, tt := range tests {
+		s, err := New(dir, WithOptsLayout(tt.layout))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.Write(logLine("prod", tt.pod, "app", "line"))
+		if tt.err && err == nil {
+			t.Errorf("layout %q with pod %q: want an error", tt.layout, tt.pod)
+		}
+		if !tt.err && err != nil {
+			t.Errorf("layout %q with pod %q: %s", tt.layout, tt.pod, err)
+		}
+		s.Close()
+	}
+}
+
+func TestRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := New(dir, WithOptsLayout("{{.Pod}}.log"), WithOptsRotation(10, 0), WithOptsCompress(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := s.Write(logLine("prod", "api-1", "app", "0123456789")); err != nil {
+			t.Fatal(err)
+		}
+		// the rotated files are named after the time
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := readManifest(t, dir)[0].Files
+	if len(files) != 3 {
+		t.Fatalf("files = %v, want 2 rotated files and the current one", files)
+	}
+	for _, file := range files[:2] {
+		if filepath.Ext(file) != ".gz" {
+			t.Errorf("rotated file %s isn't compressed", file)
+		}
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Error(err)
+		}
+	}
+	if files[2] != "api-1.log" {
+		t.Errorf("current file = %s, want api-1.log", files[2])
+	}
+}
@@ -6,10 +6,12 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
-	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp" // gke clusters
+	_ "k8s.io/client-go/plugin/pkg/client/auth" // gcp, azure, oidc and openstack auth providers
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -21,19 +23,128 @@ type (
 	PodLogOptions = v1.PodLogOptions
 	// Pod is an alias to kubernetes' Pod
 	Pod = v1.Pod
+	// ContainerStatus is an alias to kubernetes' ContainerStatus
+	ContainerStatus = v1.ContainerStatus
+	// Event is an alias to kubernetes' Event
+	Event = v1.Event
 	// LabelSelector is an alias to kubernetes' LabelSelector
 	LabelSelector = metav1.LabelSelector
+	// Time is an alias to kubernetes' Time
+	Time = metav1.Time
 )
 
+const (
+	// PodSucceeded is an alias to kubernetes' PodSucceeded phase
+	PodSucceeded = v1.PodSucceeded
+	// PodFailed is an alias to kubernetes' PodFailed phase
+	PodFailed = v1.PodFailed
+)
+
+const (
+	// listPageSize is the maximum number of objects returned by a single list request
+	listPageSize = 250
+)
+
+type config struct {
+	rules     *clientcmd.ClientConfigLoadingRules
+	overrides *clientcmd.ConfigOverrides
+	qps       float32
+	burst     int
+}
+
+// Opts is an option used to configure how the kubernetes client is built
+type Opts func(c *config)
+
+// WithOptsKubeconfig uses the given kubeconfig file instead of the default loading rules.
+//
+// An empty path keeps the default loading rules: the $KUBECONFIG path list, then ~/.kube/config.
+func WithOptsKubeconfig(path string) Opts {
+	return func(c *config) {
+		c.rules.ExplicitPath = path
+	}
+}
+
+// WithOptsContext uses the given kubeconfig context instead of the current one
+func WithOptsContext(name string) Opts {
+	return func(c *config) {
+		c.overrides.CurrentContext = name
+	}
+}
+
+// WithOptsCluster uses the given kubeconfig cluster instead of the context's one
+func WithOptsCluster(name string) Opts {
+	return func(c *config) {
+		c.overrides.Context.Cluster = name
+	}
+}
+
+// WithOptsUser uses the given kubeconfig user instead of the context's one
+func WithOptsUser(name string) Opts {
+	return func(c *config) {
+		c.overrides.Context.AuthInfo = name
+	}
+}
+
+// WithOptsImpersonate impersonates the given user and groups for all requests
+func WithOptsImpersonate(user string, groups ...string) Opts {
+	return func(c *config) {
+		c.overrides.AuthInfo.Impersonate = user
+		c.overrides.AuthInfo.ImpersonateGroups = groups
+	}
+}
+
+// WithOptsRateLimit configures the client-side rate limit of the API requests.
+//
+// A zero value keeps client-go's default (5 QPS, 10 burst).
+func WithOptsRateLimit(qps float32, burst int) Opts {
+	return func(c *config) {
+		c.qps = qps
+		c.burst = burst
+	}
+}
+
 // NewClient creates a new kubernetes client
 //
-// It uses the current context in the kubeconfig file
-func NewClient(kubeconfig string) (*Client, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+// It uses the same loading rules as kubectl: the kubeconfig files are merged and the current
+// context is used unless overridden. Exec and auth provider credential plugins are supported.
+// When no kubeconfig is found and the process runs inside a pod, the in-cluster config is used.
+func NewClient(opts ...Opts) (*Client, error) {
+	c := &config{
+		rules:     clientcmd.NewDefaultClientConfigLoadingRules(),
+		overrides: &clientcmd.ConfigOverrides{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(c.rules, c.overrides).ClientConfig()
 	if err != nil {
 		return nil, err
 	}
-	client, err := kubernetes.NewForConfig(config)
+	return newClient(restConfig, c)
+}
+
+// NewClientForConfig creates a new kubernetes client from a rest config
+//
+// Options related to the kubeconfig loading are ignored.
+func NewClientForConfig(restConfig *rest.Config, opts ...Opts) (*Client, error) {
+	c := &config{
+		rules:     clientcmd.NewDefaultClientConfigLoadingRules(),
+		overrides: &clientcmd.ConfigOverrides{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return newClient(restConfig, c)
+}
+
+func newClient(restConfig *rest.Config, c *config) (*Client, error) {
+	if c.qps > 0 {
+		restConfig.QPS = c.qps
+	}
+	if c.burst > 0 {
+		restConfig.Burst = c.burst
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -64,14 +175,97 @@ func GetService(k8s *Client, ns, name string) (*v1.Service, error) {
 	return ssSvc.Get(name, metav1.GetOptions{})
 }
 
+// GetPod gets a Pod object
+func GetPod(k8s *Client, ns, name string) (*v1.Pod, error) {
+	podsSvc := k8s.CoreV1().Pods(ns)
+	return podsSvc.Get(name, metav1.GetOptions{})
+}
+
 // ListPods lists pods matching the label selector
+//
+// Pods are retrieved by pages so large workloads don't result in a single huge request.
 func ListPods(k8s *Client, ns string, selector *LabelSelector) ([]v1.Pod, error) {
 	podsSvc := k8s.CoreV1().Pods(ns)
-	pods, err := podsSvc.List(metav1.ListOptions{LabelSelector: metav1.FormatLabelSelector(selector)})
-	if err != nil {
-		return nil, err
+	opts := metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(selector),
+		Limit:         listPageSize,
+	}
+	var ret []v1.Pod
+	for {
+		pods, err := podsSvc.List(opts)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, pods.Items...)
+		if pods.Continue == "" {
+			return ret, nil
+		}
+		opts.Continue = pods.Continue
+	}
+}
+
+// EventSelector returns the field selector of the events involving objects of the given kind,
+// or only the object with the given name if not empty
+func EventSelector(kind, name string) string {
+	set := fields.Set{"involvedObject.kind": kind}
+	if name != "" {
+		set["involvedObject.name"] = name
+	}
+	return fields.SelectorFromSet(set).String()
+}
+
+// ListEvents lists the events of a namespace matching the field selector (see EventSelector)
+func ListEvents(k8s *Client, ns string, selector string) ([]v1.Event, error) {
+	eventsSvc := k8s.CoreV1().Events(ns)
+	opts := metav1.ListOptions{FieldSelector: selector, Limit: listPageSize}
+	var ret []v1.Event
+	for {
+		events, err := eventsSvc.List(opts)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, events.Items...)
+		if events.Continue == "" {
+			return ret, nil
+		}
+		opts.Continue = events.Continue
+	}
+}
+
+// WatchEvents watches the events of a namespace matching the field selector (see EventSelector)
+//
+// onEvent is called when an event is created, and when it is updated (e.g. its count is incremented)
+func WatchEvents(k8s *Client, ns string, selector string, onEvent func(*v1.Event)) func() {
+	_, eController := cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.FieldSelector = selector
+				return k8s.CoreV1().Events(ns).List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.FieldSelector = selector
+				return k8s.CoreV1().Events(ns).Watch(options)
+			},
+		},
+		&v1.Event{},
+		0,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				onEvent(obj.(*v1.Event))
+			},
+			UpdateFunc: func(old, new interface{}) {
+				// resyncs and unrelated updates don't change the count
+				if old.(*v1.Event).Count != new.(*v1.Event).Count {
+					onEvent(new.(*v1.Event))
+				}
+			},
+		},
+	)
+	stop := make(chan struct{})
+	go eController.Run(stop)
+	return func() {
+		close(stop)
 	}
-	return pods.Items, nil
 }
 
 // GetPodLogs gets logs of a pod
@@ -82,15 +276,32 @@ func GetPodLogs(k8s *Client, ns, name string, opts *PodLogOptions) (io.ReadClose
 }
 
 // WatchPods watches pods matching the label selector
+//
+// It returns once onAdd has been called for the existing pods.
 func WatchPods(k8s *Client, ns string, selector *LabelSelector, onAdd func(*v1.Pod), onUpdate func(*v1.Pod, *v1.Pod), onDelete func(*v1.Pod)) func() {
+	return watchPods(k8s, ns, func(options *metav1.ListOptions) {
+		options.LabelSelector = metav1.FormatLabelSelector(selector)
+	}, onAdd, onUpdate, onDelete)
+}
+
+// WatchPod watches a single pod
+//
+// It returns once onAdd has been called for the pod, if it exists.
+func WatchPod(k8s *Client, ns, name string, onAdd func(*v1.Pod), onUpdate func(*v1.Pod, *v1.Pod), onDelete func(*v1.Pod)) func() {
+	return watchPods(k8s, ns, func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+	}, onAdd, onUpdate, onDelete)
+}
+
+func watchPods(k8s *Client, ns string, filter func(*metav1.ListOptions), onAdd func(*v1.Pod), onUpdate func(*v1.Pod, *v1.Pod), onDelete func(*v1.Pod)) func() {
 	_, eController := cache.NewInformer(
 		&cache.ListWatch{
 			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-				options.LabelSelector = metav1.FormatLabelSelector(selector)
+				filter(&options)
 				return k8s.CoreV1().Pods(ns).List(options)
 			},
 			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
-				options.LabelSelector = metav1.FormatLabelSelector(selector)
+				filter(&options)
 				return k8s.CoreV1().Pods(ns).Watch(options)
 			},
 		},
@@ -108,15 +319,23 @@ func WatchPods(k8s *Client, ns string, selector *LabelSelector, onAdd func(*v1.P
 				}
 			},
 			DeleteFunc: func(obj interface{}) {
-				if onDelete != nil {
-					onDelete(obj.(*v1.Pod))
+				if onDelete == nil {
+					return
+				}
+				// the deletion may have been missed, in which case we only get the last known state
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if pod, ok := obj.(*v1.Pod); ok {
+					onDelete(pod)
 				}
 			},
 		},
 	)
 	stop := make(chan struct{})
 	go eController.Run(stop)
+	cache.WaitForCacheSync(stop, eController.HasSynced)
 	return func() {
-		stop <- struct{}{}
+		close(stop)
 	}
 }
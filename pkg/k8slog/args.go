@@ -0,0 +1,51 @@
+package k8slog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResourcesFromArgs converts kubectl-style arguments into resource strings.
+//
+// The arguments can have the following forms:
+//	- TYPE NAME...: the resources "NAME..." of type "TYPE", e.g. "deploy api web"
+//	- TYPE/NAME...: e.g. "deploy/api sts/db"
+//	- NAME...: the pods "NAME..."
+// Resources without a namespace are put in the given namespace, resource strings
+// of the form namespace/type/name and local sources are returned as is.
+func ResourcesFromArgs(namespace string, args ...string) ([]string, error) {
+	ress := make([]string, 0, len(args))
+	if len(args) > 1 && !strings.Contains(args[0], "/") {
+		if _, err := strTypeToConst(args[0]); err == nil {
+			// TYPE NAME...
+			for _, name := range args[1:] {
+				if strings.Contains(name, "/") {
+					return nil, fmt.Errorf("there is no need to specify a resource type as a separate argument when passing arguments in resource/name form: %s", name)
+				}
+				ress = append(ress, namespace+"/"+args[0]+"/"+name)
+			}
+			return ress, nil
+		}
+	}
+	for _, arg := range args {
+		if IsLocal(arg) {
+			ress = append(ress, arg)
+			continue
+		}
+		chunks := strings.Split(arg, "/")
+		switch len(chunks) {
+		case 1:
+			ress = append(ress, namespace+"/pod/"+arg)
+		case 2:
+			if _, err := strTypeToConst(chunks[0]); err != nil {
+				return nil, err
+			}
+			ress = append(ress, namespace+"/"+arg)
+		case 3:
+			ress = append(ress, arg)
+		default:
+			return nil, fmt.Errorf("invalid resource: %s", arg)
+		}
+	}
+	return ress, nil
+}
@@ -0,0 +1,42 @@
+package k8slog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResourcesFromArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+		err  bool
+	}{
+		{args: []string{"api-1"}, want: []string{"prod/pod/api-1"}},
+		{args: []string{"api-1", "api-2"}, want: []string{"prod/pod/api-1", "prod/pod/api-2"}},
+		{args: []string{"deploy", "api", "web"}, want: []string{"prod/deploy/api", "prod/deploy/web"}},
+		{args: []string{"deploy/api", "sts/db"}, want: []string{"prod/deploy/api", "prod/sts/db"}},
+		{args: []string{"staging/svc/api", "api-1"}, want: []string{"staging/svc/api", "prod/pod/api-1"}},
+		{args: []string{"file:/tmp/app.log", "-"}, want: []string{"file:/tmp/app.log", "-"}},
+		// a single argument is a pod, even if it's the name of a type
+		{args: []string{"deploy"}, want: []string{"prod/pod/deploy"}},
+		{args: []string{"deploy", "deploy/api"}, err: true},
+		{args: []string{"unknown/api"}, err: true},
+		{args: []string{"a/b/c/d"}, err: true},
+	}
+	for _, tt := range tests {
+		got, err := ResourcesFromArgs("prod", tt.args...)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ResourcesFromArgs(%q) = %q, want an error", tt.args, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ResourcesFromArgs(%q): %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ResourcesFromArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
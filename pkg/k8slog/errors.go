@@ -0,0 +1,65 @@
+package k8slog
+
+import (
+	"bytes"
+	"log"
+)
+
+// Phase is the step of the log retrieval during which an error occurred
+type Phase string
+
+const (
+	// PhaseResolve is the parsing of the resource string and the retrieval of the resource
+	PhaseResolve Phase = "resolve"
+	// PhaseList is the listing of the resource's pods
+	PhaseList Phase = "list"
+	// PhaseStream is the streaming of a container's logs
+	PhaseStream Phase = "stream"
+)
+
+// Error is an error which occurred while retrieving the logs of a resource
+type Error struct {
+	// Resource is the resource string (namespace/type/name)
+	Resource string
+	// Pod is the name of the pod, if any
+	Pod string
+	// Container is the name of the container, if any
+	Container string
+	// Phase is the step during which the error occurred
+	Phase Phase
+	// Err is the underlying error
+	Err error
+}
+
+func (e *Error) Error() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(e.Resource)
+	if e.Pod != "" {
+		buffer.WriteString(", pod \"")
+		buffer.WriteString(e.Pod)
+		buffer.WriteRune('"')
+	}
+	if e.Container != "" {
+		buffer.WriteString(", container \"")
+		buffer.WriteString(e.Container)
+		buffer.WriteRune('"')
+	}
+	buffer.WriteString(": ")
+	buffer.WriteString(string(e.Phase))
+	buffer.WriteString(": ")
+	buffer.WriteString(e.Err.Error())
+	return buffer.String()
+}
+
+// Cause returns the underlying error
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// ErrorHandler is called for each error occurring while logs are retrieved
+type ErrorHandler func(err *Error)
+
+// logError is the default ErrorHandler, it prints the error using the standard logger
+func logError(err *Error) {
+	log.Println("Error:", err)
+}
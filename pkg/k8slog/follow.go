@@ -0,0 +1,228 @@
+package k8slog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/nouney/k8slog/pkg/k8s"
+	"github.com/pkg/errors"
+)
+
+// resumeDelay is the minimum delay between two resumptions of a stream which didn't bring any line
+const resumeDelay = time.Second
+
+// podTracker keeps the latest known state of a watched pod
+type podTracker struct {
+	mu      sync.Mutex
+	pod     *k8s.Pod
+	deleted bool
+	// changed is closed when the pod is updated or deleted
+	changed chan struct{}
+	// gone is closed when the pod is deleted
+	gone chan struct{}
+}
+
+func newPodTracker(pod *k8s.Pod) *podTracker {
+	return &podTracker{pod: pod, changed: make(chan struct{}), gone: make(chan struct{})}
+}
+
+func (t *podTracker) update(pod *k8s.Pod) {
+	t.mu.Lock()
+	t.pod = pod
+	close(t.changed)
+	t.changed = make(chan struct{})
+	t.mu.Unlock()
+}
+
+func (t *podTracker) delete() {
+	t.mu.Lock()
+	t.deleted = true
+	close(t.gone)
+	close(t.changed)
+	t.changed = make(chan struct{})
+	t.mu.Unlock()
+}
+
+// get returns the latest state of the pod and a channel closed on the next change
+func (t *podTracker) get() (*k8s.Pod, bool, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.pod, t.deleted, t.changed
+}
+
+// followPod follows the logs of all the containers of a watched pod
+//
+// Sync function
+func (r resource) followPod(out chan<- LogLine, t *podTracker, opts *k8s.PodLogOptions) {
+	pod, _, _ := t.get()
+	r.emit(out, LogLine{PodMeta: r.podMeta(pod, ""), Kind: KindPodAdded, Pod: pod.Name, Line: "new pod"})
+	var wg sync.WaitGroup
+	wg.Add(len(pod.Spec.Containers))
+	for _, container := range pod.Spec.Containers {
+		go func(container string) {
+			defer wg.Done()
+			r.followContainer(out, t, container, opts)
+		}(container.Name)
+	}
+	wg.Wait()
+	if _, deleted, _ := t.get(); deleted {
+		r.emit(out, LogLine{Kind: KindPodDeleted, Pod: pod.Name, Line: "pod deleted"})
+	}
+}
+
+// followContainer follows the logs of a container of a watched pod, including its restarts.
+//
+// It waits for the container to be started using the pod's updates, retries failing streams
+// according to the retry policy and gives up when the container will never start.
+//
+// Sync function
+func (r resource) followContainer(out chan<- LogLine, t *podTracker, container string, opts *k8s.PodLogOptions) {
+	policy := r.c.retry
+	bo := policy.backOff()
+	var pendingSince time.Time
+	// restart count of the last streamed instance of the container
+	streamed := int32(-1)
+	// restart count of the instance whose ended stream is resumed, and time of its last line
+	resumed := int32(-1)
+	var since time.Time
+	for {
+		if r.c.stopped() {
+			return
+		}
+		pod, deleted, changed := t.get()
+		if deleted {
+			if streamed < 0 && since.IsZero() {
+				r.abandon(pod.Name, container, "pod deleted")
+			}
+			return
+		}
+		status := containerStatus(pod, container)
+		if reason := giveUpReason(pod, status); reason != "" {
+			r.abandon(pod.Name, container, reason)
+			return
+		}
+
+		if !hasStarted(status) {
+			// wait for the pod's updates until the container is started
+			if pendingSince.IsZero() {
+				pendingSince = time.Now()
+			}
+			var timeout <-chan time.Time
+			if policy.PendingTimeout > 0 {
+				left := policy.PendingTimeout - time.Since(pendingSince)
+				if left <= 0 {
+					r.abandon(pod.Name, container, "not started after "+policy.PendingTimeout.String()+": "+waitingReason(status))
+					return
+				}
+				timeout = time.After(left)
+			}
+			select {
+			case <-changed:
+			case <-timeout:
+			case <-r.c.stop:
+			}
+			continue
+		}
+		if !pendingSince.IsZero() {
+			// the time spent pending doesn't count as failing
+			pendingSince = time.Time{}
+			bo.Reset()
+		}
+
+		if !since.IsZero() && status.RestartCount != resumed {
+			// the container restarted before its stream was resumed
+			streamed, since = resumed, time.Time{}
+		}
+
+		if status.RestartCount == streamed {
+			// this instance was already streamed, wait for a restart
+			if pod.Status.Phase == k8s.PodSucceeded || pod.Status.Phase == k8s.PodFailed {
+				return
+			}
+			select {
+			case <-changed:
+			case <-r.c.stop:
+			}
+			continue
+		}
+
+		copts := opts
+		if !since.IsZero() {
+			resume := *opts
+			resume.SinceTime = &k8s.Time{Time: since}
+			copts = &resume
+		} else if streamed >= 0 {
+			r.emitRestart(out, pod, status)
+		}
+		connected := time.Now()
+		// only the consecutive failures count: the backoff restarts once the stream is connected
+		last, err := r.getContainerLogs(out, pod, container, copts, t.gone, bo.Reset)
+		if r.c.stopped() {
+			return
+		}
+		if err == errNoRequest {
+			// the pod was deleted while waiting for a log request slot
+			continue
+		}
+		if err == nil {
+			if !r.running(pod.Name, container, status.RestartCount) {
+				streamed, since = status.RestartCount, time.Time{}
+				continue
+			}
+			// the stream was closed by the API server or the kubelet, or the log file was rotated:
+			// resume it after its last line
+			if last.IsZero() {
+				last = connected
+			}
+			if !last.After(since) {
+				// nothing new since the last resumption, don't hammer the API server
+				select {
+				case <-time.After(resumeDelay):
+				case <-changed:
+				case <-r.c.stop:
+				}
+			}
+			resumed, since = status.RestartCount, last
+			continue
+		}
+		next := bo.NextBackOff()
+		if next == backoff.Stop {
+			r.abandon(pod.Name, container, "stream failed after "+policy.MaxElapsedTime.String()+": "+err.Error())
+			return
+		}
+		r.reportError(pod.Name, container, PhaseStream, errors.Wrapf(err, "retrying in %s", next.Round(time.Millisecond)))
+		select {
+		case <-time.After(next):
+		case <-r.c.stop:
+		}
+	}
+}
+
+// running returns true if the container is still running the given instance, according to the API server
+func (r resource) running(pod, container string, restarts int32) bool {
+	p, err := k8s.GetPod(r.k8s, r.Namespace, pod)
+	if err != nil {
+		return false
+	}
+	status := containerStatus(p, container)
+	return status != nil && status.State.Running != nil && status.RestartCount == restarts
+}
+
+// emitRestart emits a restart event with the exit code of the previous instance of the container
+func (r resource) emitRestart(out chan<- LogLine, pod *k8s.Pod, status *k8s.ContainerStatus) {
+	event := LogLine{PodMeta: r.podMeta(pod, status.Name), Kind: KindContainerRestarted, Pod: pod.Name, Container: status.Name}
+	if last := status.LastTerminationState.Terminated; last != nil {
+		event.ExitCode = last.ExitCode
+		event.Line = fmt.Sprintf("restarted (exit code %d, %s)", last.ExitCode, last.Reason)
+	} else {
+		event.Line = "restarted"
+	}
+	r.emit(out, event)
+}
+
+// abandon reports that the logs of a container won't be retrieved
+func (r resource) abandon(pod, container, reason string) {
+	r.reportError(pod, container, PhaseStream, errors.Wrap(ErrAbandoned, reason))
+}
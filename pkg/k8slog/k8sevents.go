@@ -0,0 +1,168 @@
+package k8slog
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nouney/k8slog/pkg/k8s"
+)
+
+// K8sEvent is a kubernetes event involving a pod of a resource, or the resource itself
+type K8sEvent struct {
+	// Type is the type of the event (Normal, Warning)
+	Type string `json:"type"`
+	// Reason is the short reason of the event (BackOff, FailedScheduling, ...)
+	Reason string `json:"reason"`
+	// Message is the human readable description of the event
+	Message string `json:"message"`
+	// Object is the involved object (kind/name)
+	Object string `json:"object"`
+	// Count is the number of times the event occurred
+	Count int32 `json:"count"`
+}
+
+// typeKinds are the kubernetes kinds of the resource types
+var typeKinds = [lastType]string{
+	TypePod:         "Pod",
+	TypeDeploy:      "Deployment",
+	TypeStatefulSet: "StatefulSet",
+	TypeReplicaSet:  "ReplicaSet",
+	TypeService:     "Service",
+}
+
+// objectSet is a set of kubernetes objects (kind/name) involved in the logs of a resource
+type objectSet struct {
+	mu   sync.RWMutex
+	objs map[string]struct{}
+}
+
+func newObjectSet() *objectSet {
+	return &objectSet{objs: make(map[string]struct{})}
+}
+
+func (s *objectSet) add(kind, name string) {
+	s.mu.Lock()
+	s.objs[kind+"/"+name] = struct{}{}
+	s.mu.Unlock()
+}
+
+// addPod adds the pod and its owners (e.g. the replicaset of a deployment's pod)
+func (s *objectSet) addPod(pod *k8s.Pod) {
+	s.add("Pod", pod.Name)
+	for _, owner := range pod.OwnerReferences {
+		s.add(owner.Kind, owner.Name)
+	}
+}
+
+func (s *objectSet) has(kind, name string) bool {
+	s.mu.RLock()
+	_, ok := s.objs[kind+"/"+name]
+	s.mu.RUnlock()
+	return ok
+}
+
+// involvedObjects returns a set containing the resource itself
+func (r resource) involvedObjects() *objectSet {
+	objs := newObjectSet()
+	objs.add(typeKinds[r.Type], r.Name)
+	return objs
+}
+
+// eventSelectors returns the field selectors of the events which may involve the resource, its pods or their owners
+func (r resource) eventSelectors() []string {
+	switch r.Type {
+	case TypePod:
+		return []string{k8s.EventSelector("Pod", r.Name)}
+	case TypeService:
+		// the owners of the pods of a service can be of any kind
+		return []string{""}
+	}
+	selectors := []string{k8s.EventSelector(typeKinds[r.Type], r.Name), k8s.EventSelector("Pod", "")}
+	if r.Type == TypeDeploy {
+		// the pods of a deployment are owned by its replicasets
+		selectors = append(selectors, k8s.EventSelector("ReplicaSet", ""))
+	}
+	return selectors
+}
+
+// watchK8sEvents emits the kubernetes events involving the objects of the set, it returns the functions
+// stopping the watchers
+//
+// Async function
+func (r resource) watchK8sEvents(out chan<- LogLine, objs *objectSet, s *senders) []func() {
+	var stops []func()
+	for _, selector := range r.eventSelectors() {
+		stops = append(stops, k8s.WatchEvents(r.k8s, r.Namespace, selector, func(event *k8s.Event) {
+			if objs.has(event.InvolvedObject.Kind, event.InvolvedObject.Name) && s.add() {
+				out <- r.k8sEventLine(event)
+				s.done()
+			}
+		}))
+	}
+	return stops
+}
+
+// listK8sEvents emits the kubernetes events involving the resource or its pods, oldest first
+//
+// Sync function
+func (r resource) listK8sEvents(out chan<- LogLine, pods []k8s.Pod) {
+	objs := r.involvedObjects()
+	for i := range pods {
+		objs.addPod(&pods[i])
+	}
+	var events []k8s.Event
+	for _, selector := range r.eventSelectors() {
+		evs, err := k8s.ListEvents(r.k8s, r.Namespace, selector)
+		if err != nil {
+			r.reportError("", "", PhaseList, err)
+			return
+		}
+		events = append(events, evs...)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return eventTime(&events[i]).Before(eventTime(&events[j]))
+	})
+	for i := range events {
+		if objs.has(events[i].InvolvedObject.Kind, events[i].InvolvedObject.Name) {
+			out <- r.k8sEventLine(&events[i])
+		}
+	}
+}
+
+func (r resource) k8sEventLine(event *k8s.Event) LogLine {
+	obj := event.InvolvedObject
+	line := LogLine{
+		resource: r,
+		Kind:     KindK8sEvent,
+		Time:     eventTime(event),
+		Event: &K8sEvent{
+			Type:    event.Type,
+			Reason:  event.Reason,
+			Message: strings.TrimSpace(event.Message),
+			Object:  strings.ToLower(obj.Kind) + "/" + obj.Name,
+			Count:   event.Count,
+		},
+		Line: event.Type + " " + event.Reason + ": " + strings.TrimSpace(event.Message) + "\n",
+	}
+	if obj.Kind == "Pod" {
+		line.Pod = obj.Name
+	}
+	if r.c.timestamps {
+		line.Line = eventTime(event).Format(time.RFC3339Nano) + " " + line.Line
+	}
+	r.c.redact(&line)
+	return line
+}
+
+// eventTime returns the last time the event occurred
+func eventTime(event *k8s.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
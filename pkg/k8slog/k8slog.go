@@ -1,38 +1,97 @@
 package k8slog
 
 import (
-	"bytes"
-	"log"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/nouney/k8slog/pkg/k8s"
 	"github.com/pkg/errors"
-	"github.com/tidwall/gjson"
 	"k8s.io/client-go/kubernetes"
 )
 
 var (
 	// ErrInvalidResourceType is returned when the given resource type is invalid
 	ErrInvalidResourceType = errors.New("invalid resource type")
+	// ErrAbandoned is reported when the logs of a container won't be retrieved
+	ErrAbandoned = errors.New("abandoned")
+	// ErrMaxLogRequests is reported when a container waits for a free slot because of WithOptsMaxLogRequests
+	ErrMaxLogRequests = errors.New("maximum number of concurrent log requests reached")
+
+	// errNoRequest is returned when the wait for a log request slot is given up
+	errNoRequest = errors.New("no log request slot")
 )
 
-// LogLine is a log line of a pod
+// LogLine is a log line of a pod, or an event if Kind is not KindLog
 type LogLine struct {
 	resource
+	// PodMeta is the metadata of the pod and container, nil unless enabled by WithOptsPodMetadata
+	*PodMeta
 
+	// Kind is the kind of the line
+	Kind Kind
+	// Time is the time of the line: its timestamp if timestamps are enabled, otherwise when it was received
+	Time time.Time
 	// Pod is the name of the pod
 	Pod string
-	// Line is the log line itself
+	// Container is the name of the container
+	Container string
+	// Stream is the output stream of the container (stdout or stderr), only known for CRI log files
+	Stream string
+	// Line is the log line itself, or a description of the event
 	Line string
+	// ExitCode is the exit code of the previous instance of a restarted container
+	ExitCode int32
+	// Event is the kubernetes event, if Kind is KindK8sEvent
+	Event *K8sEvent
+	// Fields are the fields of the line, set by the parse stage of the pipeline (e.g. JSONParser)
+	Fields map[string]interface{}
+}
+
+// Message returns the line without its timestamp and trailing newline, for outputs having their own timestamp
+func (l *LogLine) Message() string {
+	line := strings.TrimSuffix(l.Line, "\n")
+	if i := strings.IndexByte(line, ' '); i > 0 {
+		if _, err := time.Parse(time.RFC3339Nano, line[:i]); err == nil {
+			return line[i+1:]
+		}
+	}
+	return line
+}
+
+// SetMessage replaces the message of the line, keeping its timestamp if any
+func (l *LogLine) SetMessage(msg string) {
+	line := strings.TrimSuffix(l.Line, "\n")
+	l.Line = line[:len(line)-len(l.Message())] + msg + "\n"
 }
 
 // Client allows to retrieve logs of differents resources on k8s
 type Client struct {
-	k8s           *kubernetes.Clientset
-	jsonFields    []string
-	jsonFieldsLen int
-	follow        bool
-	timestamps    bool
+	k8s          *kubernetes.Clientset
+	follow       bool
+	timestamps   bool
+	bufferSize   int
+	bufferPolicy BufferPolicy
+	dropNotice   time.Duration
+	drops        *dropCounter
+	maxRequests  int
+	requests     chan struct{}
+	retry        RetryPolicy
+	onError      ErrorHandler
+	events       bool
+	k8sEvents    bool
+	metadata     bool
+	annotations  []string
+	recorder     *Recorder
+	redactor     Redactor
+	pipeline     *Pipeline
+	pipelines    map[string]*Pipeline
+	collapse     CollapseMode
+	lineRate     int
+	// optErrs are the errors of the options, reported once they are all applied
+	optErrs []*Error
+	// stop is closed to stop following the logs, see LogsUntil
+	stop <-chan struct{}
 }
 
 // Opts is an option used to configure Client
@@ -58,23 +117,147 @@ func WithOptsTimestamps(value bool) Opts {
 // WithOptsJSONFields configure the json option (default: none).
 //
 // If enabled, log lines will be handled as JSON objects and only the given fields will be printed.
+// It adds a JSONProjector to the project stage of the pipeline.
 func WithOptsJSONFields(fields ...string) Opts {
 	return func(c *Client) {
-		c.jsonFields = fields
-		c.jsonFieldsLen = len(fields)
-		if c.jsonFieldsLen > 0 {
-			// disable timestamps so we can parse the json object
-			WithOptsTimestamps(true)(c)
+		if len(fields) > 0 {
+			c.pipeline.Add(StageProject, JSONProjector(fields...))
+		}
+	}
+}
+
+// WithOptsProcessor adds a processor at the end of a stage of the pipeline (default: none)
+func WithOptsProcessor(stage Stage, proc Processor) Opts {
+	return func(c *Client) {
+		c.pipeline.Add(stage, proc)
+	}
+}
+
+// WithOptsResourcePipeline replaces the pipeline for the logs of a resource, given like to Logs (e.g. prod/deploy/api).
+//
+// Use the Clone of a pipeline to extend it. An invalid resource is reported to the error handler.
+func WithOptsResourcePipeline(res string, p *Pipeline) Opts {
+	return func(c *Client) {
+		key, err := pipelineKey(res)
+		if err != nil {
+			c.optErrs = append(c.optErrs, &Error{Resource: res, Phase: PhaseResolve, Err: errors.Wrap(err, "resource pipeline")})
+			return
 		}
+		c.pipelines[key] = p
+	}
+}
+
+// pipelineKey returns the id of the resource whose lines use a resource pipeline, see resource.id
+func pipelineKey(res string) (string, error) {
+	if IsLocal(res) {
+		return res, nil
+	}
+	ns, typ, name, err := ParseResource(res)
+	if err != nil {
+		return "", err
+	}
+	return ns + "/" + typ.String() + "/" + name, nil
+}
+
+// WithOptsBuffer configures the per-pod buffers (default: 1024 lines, BufferBlock).
+//
+// Each pod's log stream is buffered so a slow consumer doesn't stall the other streams.
+// When a buffer is full, the policy decides whether the stream blocks or lines are dropped.
+// A size of 0 disables the buffers.
+func WithOptsBuffer(size int, policy BufferPolicy) Opts {
+	return func(c *Client) {
+		c.bufferSize = size
+		c.bufferPolicy = policy
+	}
+}
+
+// WithOptsDropNotices configures the interval between two "N lines dropped" notices (default: 10s).
+//
+// A value of 0 disables the notices.
+func WithOptsDropNotices(interval time.Duration) Opts {
+	return func(c *Client) {
+		c.dropNotice = interval
+	}
+}
+
+// WithOptsMaxLogRequests limits the number of concurrent log requests (default: 0, unlimited).
+//
+// Log streams exceeding the limit are queued, reported with ErrMaxLogRequests, and started as soon as
+// another stream ends. Followed streams waiting for a slot are dropped if their pod is deleted.
+func WithOptsMaxLogRequests(value int) Opts {
+	return func(c *Client) {
+		c.maxRequests = value
+	}
+}
+
+// WithOptsRetryPolicy configures how the log streams of watched pods are retried (default: DefaultRetryPolicy)
+func WithOptsRetryPolicy(policy RetryPolicy) Opts {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithOptsErrorHandler configures the function called for each error (default: print with the standard logger).
+//
+// Errors occurring after Logs returned, like a failing pod stream, are only reported through this handler.
+func WithOptsErrorHandler(handler ErrorHandler) Opts {
+	return func(c *Client) {
+		c.onError = handler
+	}
+}
+
+// WithOptsEvents enables the pod lifecycle events in the log stream (default: false).
+//
+// Only emitted if the follow option is enabled. Events are LogLines with a Kind other than KindLog.
+func WithOptsEvents(value bool) Opts {
+	return func(c *Client) {
+		c.events = value
+	}
+}
+
+// WithOptsK8sEvents enables the kubernetes events in the log stream (default: false).
+//
+// Events involving the resource, its pods or their owners (e.g. replicasets) are interleaved with the logs.
+// Such lines have the kind KindK8sEvent.
+func WithOptsK8sEvents(value bool) Opts {
+	return func(c *Client) {
+		c.k8sEvents = value
+	}
+}
+
+// WithOptsPodMetadata enables the pod metadata of the log lines (default: false).
+//
+// The metadata (labels, node, pod IP, owner, container image, restart count and the given annotations)
+// is retrieved once per container stream, not per line.
+func WithOptsPodMetadata(value bool, annotations ...string) Opts {
+	return func(c *Client) {
+		c.metadata = value
+		c.annotations = annotations
 	}
 }
 
 // New creates a new Client
 func New(k8s *kubernetes.Clientset, opts ...Opts) *Client {
-	c := &Client{k8s: k8s, timestamps: true}
+	c := &Client{
+		k8s:        k8s,
+		timestamps: true,
+		bufferSize: defaultBufferSize,
+		dropNotice: defaultDropNotice,
+		drops:      newDropCounter(),
+		retry:      DefaultRetryPolicy,
+		onError:    logError,
+		pipeline:   NewPipeline(),
+		pipelines:  make(map[string]*Pipeline),
+	}
 	for _, opt := range opts {
 		opt(c)
 	}
+	for _, err := range c.optErrs {
+		c.reportError(err)
+	}
+	if c.maxRequests > 0 {
+		c.requests = make(chan struct{}, c.maxRequests)
+	}
 	return c
 }
 
@@ -90,70 +273,132 @@ func New(k8s *kubernetes.Clientset, opts ...Opts) *Client {
 //	- deploy/mysvc: all the pods of the deployment "mysvc" in namespace "default"
 //	- prod/deploy/mysvc: all the pods of the deployment "mysvc" in namespace "prod"
 func (c Client) Logs(ress ...string) (<-chan LogLine, error) {
+	return c.LogsUntil(nil, ress...)
+}
+
+// LogsUntil retrieves logs like Logs, until stop is closed.
+//
+// Once stop is closed, the pods are no longer watched, the log streams are closed and so is the returned channel,
+// which must be read until then. A nil stop never stops following the logs.
+func (c Client) LogsUntil(stop <-chan struct{}, ress ...string) (<-chan LogLine, error) {
+	c.stop = stop
+	// resolve all the resources first so invalid or missing resources are reported right away
+	rs := make([]Resource, 0, len(ress))
+	for _, res := range ress {
+		r, err := c.resolve(res)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+
 	out := make(chan LogLine)
 	go func() {
-		// no need to wait if we follow
-		var wg sync.WaitGroup
-		if !c.follow {
-			wg.Add(len(ress))
+		done := make(chan struct{})
+		if c.dropNotice > 0 {
+			go c.drops.notifyEvery(c.dropNotice, done)
 		}
 
-		for _, res := range ress {
-			go func(res string) {
+		var wg sync.WaitGroup
+		wg.Add(len(rs))
+		for _, r := range rs {
+			go func(r Resource) {
 				defer wg.Done()
-				err := c.logs(out, res)
-				if err != nil {
-					log.Println("Error:", err)
-				}
-			}(res)
+				c.logs(out, r)
+			}(r)
 		}
 
-		// no need to wait if we follow
-		if !c.follow {
+		// no need to wait if we follow forever
+		if !c.follow || c.stop != nil {
 			wg.Wait()
+			close(done)
 			close(out)
 		}
 	}()
 	return out, nil
 }
 
+// resolve creates a resource and retrieves it from kubernetes
+func (c *Client) resolve(res string) (Resource, error) {
+	r, err := c.newResource(res)
+	if err != nil {
+		return nil, &Error{Resource: res, Phase: PhaseResolve, Err: err}
+	}
+	if rr, ok := r.(resolver); ok {
+		if err := rr.resolve(); err != nil {
+			return nil, &Error{Resource: rr.id(), Phase: PhaseResolve, Err: err}
+		}
+	}
+	return r, nil
+}
+
+// reportError calls the error handler, if any
+func (c Client) reportError(err *Error) {
+	if c.onError != nil {
+		c.onError(err)
+	}
+}
+
+// stopped returns true once the logs are stopped, see LogsUntil
+func (c Client) stopped() bool {
+	select {
+	case <-c.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Dropped returns the number of lines dropped per pod ("namespace/pod") because of full buffers
+func (c Client) Dropped() map[string]uint64 {
+	return c.drops.snapshot()
+}
+
 // logs retrieve logs of a resource
 //
 // Sync function
-func (c Client) logs(out chan<- LogLine, res string) error {
-	r, err := NewResource(c.k8s, res)
-	if err != nil {
-		return err
+func (c Client) logs(out chan<- LogLine, r Resource) {
+	var id string
+	if rr, ok := r.(resolver); ok {
+		id = rr.id()
 	}
 	stream, err := r.GetLogs(&k8s.PodLogOptions{Timestamps: c.timestamps, Follow: c.follow})
 	if err != nil {
-		return err
+		c.reportError(&Error{Resource: id, Phase: PhaseList, Err: err})
+		return
+	}
+	// the repeated lines and the lines above the rate limit are throttled after the pipeline
+	var th *throttle
+	var tick <-chan time.Time
+	if c.collapse != CollapseNone || c.lineRate > 0 {
+		th = newThrottle(c.collapse, c.lineRate)
+		ticker := time.NewTicker(throttleInterval)
+		defer ticker.Stop()
+		tick = ticker.C
 	}
 	for {
-		line, ok := <-stream
-		if !ok {
-			break
+		select {
+		case line, ok := <-stream:
+			if !ok {
+				if th != nil {
+					th.flush(out)
+				}
+				return
+			}
+			c.redact(&line)
+			if c.recorder != nil {
+				c.recorder.record(&line)
+			}
+			if !c.process(id, &line) {
+				continue
+			}
+			if th != nil {
+				th.push(out, line)
+				continue
+			}
+			out <- line
+		case <-tick:
+			th.flush(out)
 		}
-		line.Line = c.refineLine(line.Line)
-		out <- line
-	}
-	return nil
-}
-
-func (c Client) refineLine(line string) string {
-	if c.jsonFieldsLen == 0 {
-		return line
-	}
-	var buffer bytes.Buffer
-	field := c.jsonFields[0]
-	value := gjson.Get(line, field)
-	buffer.WriteString(value.String())
-	for i := 1; i < c.jsonFieldsLen; i++ {
-		buffer.WriteRune(' ')
-		field := c.jsonFields[i]
-		value := gjson.Get(line, field)
-		buffer.WriteString(value.String())
 	}
-	buffer.WriteRune('\n')
-	return buffer.String()
 }
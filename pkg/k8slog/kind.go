@@ -0,0 +1,134 @@
+package k8slog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kind is the kind of a LogLine: a log line or a pod lifecycle event
+type Kind int
+
+const (
+	// KindLog is a log line of a container
+	KindLog Kind = iota
+	// KindPodAdded is emitted when a pod matching the resource is found
+	KindPodAdded
+	// KindContainerStarted is emitted when the log stream of a container starts
+	KindContainerStarted
+	// KindStreamEnded is emitted when the log stream of a container ends
+	KindStreamEnded
+	// KindContainerRestarted is emitted when a container restarts, ExitCode is set
+	KindContainerRestarted
+	// KindPodDeleted is emitted when a pod is deleted
+	KindPodDeleted
+	// KindK8sEvent is a kubernetes event involving the resource or one of its pods, Event is set
+	KindK8sEvent
+
+	lastKind = KindK8sEvent + 1
+)
+
+var kindNames = [lastKind]string{
+	KindLog:                "log",
+	KindPodAdded:           "pod-added",
+	KindContainerStarted:   "container-started",
+	KindStreamEnded:        "stream-ended",
+	KindContainerRestarted: "container-restarted",
+	KindPodDeleted:         "pod-deleted",
+	KindK8sEvent:           "k8s-event",
+}
+
+// String returns the name of the kind
+func (k Kind) String() string {
+	if k < 0 || k >= lastKind {
+		return "unknown"
+	}
+	return kindNames[k]
+}
+
+// IsLifecycle returns true if the kind is a pod lifecycle event
+func (k Kind) IsLifecycle() bool {
+	return k != KindLog && k != KindK8sEvent
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (k *Kind) UnmarshalText(text []byte) error {
+	for i, name := range kindNames {
+		if name == string(text) {
+			*k = Kind(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown kind: %s", text)
+}
+
+// jsonLogLine is the JSON representation of a LogLine
+type jsonLogLine struct {
+	Kind      Kind                   `json:"kind"`
+	Time      time.Time              `json:"time"`
+	Namespace string                 `json:"namespace"`
+	Type      string                 `json:"type"`
+	Name      string                 `json:"name"`
+	Pod       string                 `json:"pod"`
+	Container string                 `json:"container,omitempty"`
+	Stream    string                 `json:"stream,omitempty"`
+	Line      string                 `json:"line"`
+	ExitCode  *int32                 `json:"exitCode,omitempty"`
+	Event     *K8sEvent              `json:"event,omitempty"`
+	Meta      *PodMeta               `json:"meta,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (l LogLine) MarshalJSON() ([]byte, error) {
+	jl := jsonLogLine{
+		Kind:      l.Kind,
+		Time:      l.Time,
+		Namespace: l.Namespace,
+		Type:      l.Type.String(),
+		Name:      l.Name,
+		Pod:       l.Pod,
+		Container: l.Container,
+		Stream:    l.Stream,
+		Line:      strings.TrimSuffix(l.Line, "\n"),
+		Event:     l.Event,
+		Meta:      l.PodMeta,
+		Fields:    l.Fields,
+	}
+	if l.Kind == KindContainerRestarted {
+		jl.ExitCode = &l.ExitCode
+	}
+	return json.Marshal(jl)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+//
+// The line gets back its trailing newline, an unknown resource type is decoded as TypeUnknown.
+func (l *LogLine) UnmarshalJSON(data []byte) error {
+	var jl jsonLogLine
+	if err := json.Unmarshal(data, &jl); err != nil {
+		return err
+	}
+	*l = LogLine{
+		resource:  resource{Type: typeFromName(jl.Type), Namespace: jl.Namespace, Name: jl.Name},
+		PodMeta:   jl.Meta,
+		Kind:      jl.Kind,
+		Time:      jl.Time,
+		Pod:       jl.Pod,
+		Container: jl.Container,
+		Stream:    jl.Stream,
+		Line:      jl.Line + "\n",
+		Event:     jl.Event,
+		Fields:    jl.Fields,
+	}
+	if jl.ExitCode != nil {
+		l.ExitCode = *jl.ExitCode
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package k8slog
+
+import (
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Level is the severity of a log line, detected from its content
+type Level int
+
+const (
+	// LevelUnknown is the level of lines without a known level
+	LevelUnknown Level = iota
+	// LevelTrace is the level of trace lines
+	LevelTrace
+	// LevelDebug is the level of debug lines
+	LevelDebug
+	// LevelInfo is the level of info lines
+	LevelInfo
+	// LevelWarn is the level of warning lines
+	LevelWarn
+	// LevelError is the level of error lines
+	LevelError
+	// LevelFatal is the level of fatal lines (fatal, panic, critical)
+	LevelFatal
+
+	lastLevel = LevelFatal + 1
+)
+
+var levelNames = [lastLevel]string{
+	LevelUnknown: "unknown",
+	LevelTrace:   "trace",
+	LevelDebug:   "debug",
+	LevelInfo:    "info",
+	LevelWarn:    "warn",
+	LevelError:   "error",
+	LevelFatal:   "fatal",
+}
+
+// levelWords are the words naming a level, in lower case
+var levelWords = map[string]Level{
+	"trace":    LevelTrace,
+	"debug":    LevelDebug,
+	"dbg":      LevelDebug,
+	"info":     LevelInfo,
+	"inf":      LevelInfo,
+	"notice":   LevelInfo,
+	"warn":     LevelWarn,
+	"warning":  LevelWarn,
+	"wrn":      LevelWarn,
+	"error":    LevelError,
+	"err":      LevelError,
+	"fatal":    LevelFatal,
+	"panic":    LevelFatal,
+	"critical": LevelFatal,
+	"crit":     LevelFatal,
+}
+
+// levelFields are the JSON fields usually holding the level
+var levelFields = []string{"level", "severity", "lvl", "loglevel", "log.level"}
+
+// String returns the name of the level
+func (l Level) String() string {
+	if l < 0 || l >= lastLevel {
+		return levelNames[LevelUnknown]
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level named by the word (case insensitive), LevelUnknown if none
+func ParseLevel(word string) Level {
+	return levelWords[strings.ToLower(word)]
+}
+
+// DetectLevel detects the level of a log message.
+//
+// The level is read from the level field of JSON lines, logfmt's level=, or the first words of the line
+// (e.g. "ERROR ...", "[warn] ...", "E1018 ..." for klog).
+func DetectLevel(msg string) Level {
+	msg = strings.TrimSpace(msg)
+	if strings.HasPrefix(msg, "{") {
+		for _, field := range levelFields {
+			if value := gjson.Get(msg, field); value.Exists() {
+				return ParseLevel(value.String())
+			}
+		}
+		return LevelUnknown
+	}
+	if i := strings.Index(msg, "level="); i >= 0 {
+		value := strings.Trim(strings.SplitN(msg[i+len("level="):]+" ", " ", 2)[0], `"`)
+		return ParseLevel(value)
+	}
+	// klog: Lmmdd hh:mm:ss.uuuuuu
+	if len(msg) > 5 && strings.ContainsRune("IWEF", rune(msg[0])) && isDigits(msg[1:5]) {
+		return map[byte]Level{'I': LevelInfo, 'W': LevelWarn, 'E': LevelError, 'F': LevelFatal}[msg[0]]
+	}
+	words := strings.FieldsFunc(msg, func(r rune) bool {
+		return r == ' ' || r == '[' || r == ']' || r == ':' || r == '|'
+	})
+	for i := 0; i < len(words) && i < 3; i++ {
+		if level := ParseLevel(words[i]); level != LevelUnknown {
+			return level
+		}
+	}
+	return LevelUnknown
+}
+
+func isDigits(str string) bool {
+	for _, r := range str {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
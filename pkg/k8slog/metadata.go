@@ -0,0 +1,109 @@
+package k8slog
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/nouney/k8slog/pkg/k8s"
+)
+
+// PodMeta is the metadata of the pod and container of a log line
+type PodMeta struct {
+	// Labels are the labels of the pod
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are the selected annotations of the pod
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Node is the name of the node running the pod
+	Node string `json:"node,omitempty"`
+	// PodIP is the IP address of the pod
+	PodIP string `json:"podIP,omitempty"`
+	// Owner is the controller of the pod (kind/name)
+	Owner string `json:"owner,omitempty"`
+	// Image is the image of the container
+	Image string `json:"image,omitempty"`
+	// RestartCount is the number of restarts of the container
+	RestartCount int32 `json:"restartCount"`
+}
+
+// podMeta returns the metadata of a container of the pod, nil if disabled
+//
+// It is built once per container stream and shared by all its lines.
+func (r resource) podMeta(pod *k8s.Pod, container string) *PodMeta {
+	if !r.c.metadata {
+		return nil
+	}
+	meta := &PodMeta{
+		Labels: pod.Labels,
+		Node:   pod.Spec.NodeName,
+		PodIP:  pod.Status.PodIP,
+	}
+	if len(r.c.annotations) > 0 {
+		meta.Annotations = make(map[string]string)
+		for _, key := range r.c.annotations {
+			if value, ok := pod.Annotations[key]; ok {
+				meta.Annotations[key] = value
+			}
+		}
+	}
+	for _, owner := range pod.OwnerReferences {
+		if owner.Controller != nil && *owner.Controller {
+			meta.Owner = strings.ToLower(owner.Kind) + "/" + owner.Name
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Name == container {
+			meta.Image = c.Image
+		}
+	}
+	if status := containerStatus(pod, container); status != nil {
+		meta.RestartCount = status.RestartCount
+	}
+	return meta
+}
+
+// Field returns the value of a field of the log line, used by filters.
+//
+// Fields are namespace, pod, container, stream, kind and the metadata fields (see PodMeta.Field).
+func (l *LogLine) Field(name string) (string, bool) {
+	switch name {
+	case "namespace":
+		return l.Namespace, true
+	case "pod":
+		return l.Pod, true
+	case "container":
+		return l.Container, true
+	case "stream":
+		return l.Stream, true
+	case "kind":
+		return l.Kind.String(), true
+	}
+	return l.PodMeta.Field(name)
+}
+
+// Field returns the value of a metadata field, used by filters.
+//
+// Fields are node, ip, owner, image, restarts, label.<key> and annotation.<key>.
+func (m *PodMeta) Field(name string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	switch {
+	case name == "node":
+		return m.Node, true
+	case name == "ip":
+		return m.PodIP, true
+	case name == "owner":
+		return m.Owner, true
+	case name == "image":
+		return m.Image, true
+	case name == "restarts":
+		return strconv.Itoa(int(m.RestartCount)), true
+	case strings.HasPrefix(name, "label."):
+		value, ok := m.Labels[strings.TrimPrefix(name, "label.")]
+		return value, ok
+	case strings.HasPrefix(name, "annotation."):
+		value, ok := m.Annotations[strings.TrimPrefix(name, "annotation.")]
+		return value, ok
+	}
+	return "", false
+}
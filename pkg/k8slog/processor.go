@@ -0,0 +1,168 @@
+package k8slog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Stage is a step of the processing pipeline, stages are run in the order of their declaration
+type Stage int
+
+const (
+	// StageParse extracts the fields of the line, e.g. from JSON
+	StageParse Stage = iota
+	// StageEnrich adds information to the line
+	StageEnrich
+	// StageFilter drops lines
+	StageFilter
+	// StageTransform modifies the line
+	StageTransform
+	// StageProject builds the printed line, e.g. from a few fields
+	StageProject
+
+	lastStage = StageProject + 1
+)
+
+var stageNames = [lastStage]string{
+	StageParse:     "parse",
+	StageEnrich:    "enrich",
+	StageFilter:    "filter",
+	StageTransform: "transform",
+	StageProject:   "project",
+}
+
+// String returns the name of the stage
+func (s Stage) String() string {
+	if s < 0 || s >= lastStage {
+		return "unknown"
+	}
+	return stageNames[s]
+}
+
+// Processor is a step of the processing of the log lines
+type Processor interface {
+	// Process modifies the line, it returns false to drop it
+	Process(line *LogLine) bool
+}
+
+// ProcessorFunc is a function used as a Processor
+type ProcessorFunc func(line *LogLine) bool
+
+// Process implements Processor
+func (f ProcessorFunc) Process(line *LogLine) bool {
+	return f(line)
+}
+
+// Pipeline is an ordered list of processors.
+//
+// Processors run stage by stage, in the order they were added within a stage. Only the log lines
+// go through the pipeline, not the events.
+type Pipeline struct {
+	stages [lastStage][]Processor
+}
+
+// NewPipeline creates an empty Pipeline
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+// Add adds a processor at the end of the stage
+func (p *Pipeline) Add(stage Stage, proc Processor) *Pipeline {
+	p.stages[stage] = append(p.stages[stage], proc)
+	return p
+}
+
+// Clone returns a copy of the pipeline, so it can be extended without modifying the original
+func (p *Pipeline) Clone() *Pipeline {
+	clone := &Pipeline{}
+	for stage, procs := range p.stages {
+		clone.stages[stage] = append([]Processor(nil), procs...)
+	}
+	return clone
+}
+
+// Process runs the processors on the line, it returns false if one of them dropped it
+func (p *Pipeline) Process(line *LogLine) bool {
+	for _, procs := range p.stages {
+		for _, proc := range procs {
+			if !proc.Process(line) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// JSONParser parses the JSON lines into the Fields of the line, other lines are left as is
+var JSONParser = ProcessorFunc(func(line *LogLine) bool {
+	msg := line.Message()
+	if !strings.HasPrefix(msg, "{") {
+		return true
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(msg), &fields); err == nil {
+		line.Fields = fields
+	}
+	return true
+})
+
+// JSONProjector replaces the JSON lines by the values of the given fields (gjson paths), separated by spaces
+func JSONProjector(fields ...string) Processor {
+	return ProcessorFunc(func(line *LogLine) bool {
+		msg := line.Message()
+		var buffer bytes.Buffer
+		for i, field := range fields {
+			if i > 0 {
+				buffer.WriteRune(' ')
+			}
+			buffer.WriteString(gjson.Get(msg, field).String())
+		}
+		buffer.WriteRune('\n')
+		line.Line = buffer.String()
+		return true
+	})
+}
+
+// Redactor masks sensitive data, e.g. a redact.Redactor
+type Redactor interface {
+	Processor
+	// Redact masks the sensitive data of a string
+	Redact(s string) string
+}
+
+// WithOptsRedactor masks the log lines before they are recorded and processed (default: none).
+//
+// The messages of the kubernetes events are masked as well, the lifecycle events aren't.
+func WithOptsRedactor(r Redactor) Opts {
+	return func(c *Client) {
+		c.redactor = r
+	}
+}
+
+// redact masks the log lines and the kubernetes events with the redactor, if any
+func (c Client) redact(line *LogLine) {
+	if c.redactor == nil {
+		return
+	}
+	switch line.Kind {
+	case KindLog:
+		c.redactor.Process(line)
+	case KindK8sEvent:
+		line.Event.Message = c.redactor.Redact(line.Event.Message)
+		line.SetMessage(c.redactor.Redact(line.Message()))
+	}
+}
+
+// process runs the pipeline of the resource on a log line, it returns false if the line is dropped
+func (c Client) process(res string, line *LogLine) bool {
+	if line.Kind != KindLog {
+		return true
+	}
+	if p, ok := c.pipelines[res]; ok {
+		return p.Process(line)
+	}
+	return c.pipeline.Process(line)
+}
@@ -0,0 +1,132 @@
+package k8slog
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tag appends its name to the line, it drops the line if drop is set
+func tag(name string, drop bool) Processor {
+	return ProcessorFunc(func(line *LogLine) bool {
+		line.Line += name + " "
+		return !drop
+	})
+}
+
+func TestPipelineStages(t *testing.T) {
+	p := NewPipeline().
+		Add(StageProject, tag("project", false)).
+		Add(StageFilter, tag("filter1", false)).
+		Add(StageParse, tag("parse", false)).
+		Add(StageTransform, tag("transform", false)).
+		Add(StageFilter, tag("filter2", false)).
+		Add(StageEnrich, tag("enrich", false))
+	line := LogLine{Kind: KindLog}
+	if !p.Process(&line) {
+		t.Fatal("line dropped")
+	}
+	if want := "parse enrich filter1 filter2 transform project "; line.Line != want {
+		t.Errorf("processors run as %q, want %q", line.Line, want)
+	}
+
+	// a dropped line doesn't go through the next processors
+	clone := p.Clone().Add(StageFilter, tag("drop", true))
+	line = LogLine{Kind: KindLog}
+	if clone.Process(&line) {
+		t.Error("line not dropped")
+	}
+	if want := "parse enrich filter1 filter2 drop "; line.Line != want {
+		t.Errorf("processors run as %q, want %q", line.Line, want)
+	}
+	// the original isn't modified by its clone
+	line = LogLine{Kind: KindLog}
+	if !p.Process(&line) || strings.Contains(line.Line, "drop") {
+		t.Errorf("the clone modified the pipeline: %q", line.Line)
+	}
+}
+
+func TestJSONParser(t *testing.T) {
+	tests := []struct {
+		line   string
+		fields map[string]interface{}
+	}{
+		{line: `{"level":"error","msg":"boom","code":500}` + "\n", fields: map[string]interface{}{"level": "error", "msg": "boom", "code": 500.0}},
+		{line: `2024-01-02T03:04:05Z {"level":"info"}` + "\n", fields: map[string]interface{}{"level": "info"}},
+		{line: "level=error msg=boom\n"},
+		{line: `{"level":` + "\n"},
+	}
+	for _, tt := range tests {
+		line := LogLine{Kind: KindLog, Line: tt.line}
+		if !JSONParser.Process(&line) {
+			t.Errorf("%q dropped", tt.line)
+		}
+		if !reflect.DeepEqual(line.Fields, tt.fields) {
+			t.Errorf("%q parsed as %v, want %v", tt.line, line.Fields, tt.fields)
+		}
+		if line.Line != tt.line {
+			t.Errorf("%q modified as %q", tt.line, line.Line)
+		}
+	}
+}
+
+func TestJSONProjector(t *testing.T) {
+	proj := JSONProjector("level", "http.status", "missing", "msg")
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: `{"level":"error","msg":"boom","http":{"status":500}}` + "\n", want: "error 500  boom\n"},
+		{line: `2024-01-02T03:04:05Z {"level":"info","msg":"ok"}` + "\n", want: "info   ok\n"},
+		{line: "not json\n", want: "   \n"},
+	}
+	for _, tt := range tests {
+		line := LogLine{Kind: KindLog, Line: tt.line}
+		if !proj.Process(&line) {
+			t.Errorf("%q dropped", tt.line)
+		}
+		if line.Line != tt.want {
+			t.Errorf("%q projected as %q, want %q", tt.line, line.Line, tt.want)
+		}
+	}
+}
+
+func TestResourcePipeline(t *testing.T) {
+	var reported []string
+	api := NewPipeline().Add(StageTransform, tag("api", false))
+	source := NewPipeline().Add(StageTransform, tag("source", false))
+	c := New(nil,
+		WithOptsProcessor(StageTransform, tag("default", false)),
+		// the resources are given like to Logs, not as ids
+		WithOptsResourcePipeline("prod/deploy/api", api),
+		WithOptsResourcePipeline("file:/var/log/app.log", source),
+		WithOptsResourcePipeline("cronjob/backup", NewPipeline()),
+		WithOptsErrorHandler(func(err *Error) {
+			reported = append(reported, err.Error())
+		}),
+	)
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id: "prod/deployment/api", want: "api "},
+		{id: "staging/deployment/api", want: "default "},
+		{id: "file:/var/log/app.log", want: "source "},
+	}
+	for _, tt := range tests {
+		line := LogLine{Kind: KindLog}
+		c.process(tt.id, &line)
+		if line.Line != tt.want {
+			t.Errorf("lines of %s processed by %q, want %q", tt.id, line.Line, tt.want)
+		}
+	}
+	// only the log lines are processed
+	event := LogLine{Kind: KindPodAdded, Line: "new pod"}
+	if !c.process("prod/deployment/api", &event) || event.Line != "new pod" {
+		t.Errorf("event processed as %q", event.Line)
+	}
+	want := []string{"cronjob/backup: resolve: resource pipeline: unknown resource type: cronjob"}
+	if !reflect.DeepEqual(reported, want) {
+		t.Errorf("errors reported %q, want %q", reported, want)
+	}
+}
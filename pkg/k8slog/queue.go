@@ -0,0 +1,188 @@
+package k8slog
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BufferPolicy is the behavior of a pod's buffer when it is full
+type BufferPolicy int
+
+const (
+	// BufferBlock blocks the pod's log stream until the consumer catches up
+	BufferBlock BufferPolicy = iota
+	// BufferDropOldest drops the oldest buffered line to make room for the new one
+	BufferDropOldest
+	// BufferDropNewest drops the new line
+	BufferDropNewest
+)
+
+const (
+	defaultBufferSize = 1024
+	defaultDropNotice = 10 * time.Second
+)
+
+// ParseBufferPolicy converts a string (block, drop-oldest, drop-newest) to a BufferPolicy
+func ParseBufferPolicy(str string) (BufferPolicy, error) {
+	switch str {
+	case "block":
+		return BufferBlock, nil
+	case "drop-oldest":
+		return BufferDropOldest, nil
+	case "drop-newest":
+		return BufferDropNewest, nil
+	default:
+		return BufferBlock, fmt.Errorf("unknown buffer policy: %s", str)
+	}
+}
+
+// podQueue is a bounded queue of log lines of a single pod.
+//
+// Lines are pushed by the pod's log stream and delivered to the output channel
+// by a dedicated goroutine so a slow consumer doesn't stall the stream.
+type podQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	lines  []LogLine
+	head   int
+	size   int
+	closed bool
+	done   chan struct{}
+	policy BufferPolicy
+	out    chan<- LogLine
+	onDrop func()
+}
+
+func newPodQueue(out chan<- LogLine, size int, policy BufferPolicy, onDrop func()) *podQueue {
+	q := &podQueue{out: out, policy: policy, onDrop: onDrop, done: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+	if size <= 0 {
+		// unbuffered: lines are sent directly to the output channel
+		close(q.done)
+		return q
+	}
+	q.lines = make([]LogLine, size)
+	go q.run()
+	return q
+}
+
+// push adds a line to the queue, applying the buffer policy if it is full
+func (q *podQueue) push(line LogLine) {
+	if q.lines == nil {
+		q.out <- line
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.size == len(q.lines) {
+		switch q.policy {
+		case BufferDropNewest:
+			q.onDrop()
+			return
+		case BufferDropOldest:
+			q.head = (q.head + 1) % len(q.lines)
+			q.size--
+			q.onDrop()
+		default:
+			for q.size == len(q.lines) {
+				q.cond.Wait()
+			}
+		}
+	}
+	q.lines[(q.head+q.size)%len(q.lines)] = line
+	q.size++
+	q.cond.Broadcast()
+}
+
+// close waits for the buffered lines to be delivered
+func (q *podQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	<-q.done
+}
+
+func (q *podQueue) run() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for q.size == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.size == 0 {
+			q.mu.Unlock()
+			return
+		}
+		line := q.lines[q.head]
+		q.lines[q.head] = LogLine{}
+		q.head = (q.head + 1) % len(q.lines)
+		q.size--
+		q.cond.Broadcast()
+		q.mu.Unlock()
+		q.out <- line
+	}
+}
+
+// dropCounter counts the lines dropped per pod
+type dropCounter struct {
+	mu      sync.Mutex
+	total   map[string]uint64
+	pending map[string]uint64
+}
+
+func newDropCounter() *dropCounter {
+	return &dropCounter{total: make(map[string]uint64), pending: make(map[string]uint64)}
+}
+
+func (d *dropCounter) inc(pod string) {
+	d.mu.Lock()
+	d.total[pod]++
+	d.pending[pod]++
+	d.mu.Unlock()
+}
+
+// snapshot returns a copy of the total of dropped lines per pod
+func (d *dropCounter) snapshot() map[string]uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ret := make(map[string]uint64, len(d.total))
+	for pod, n := range d.total {
+		ret[pod] = n
+	}
+	return ret
+}
+
+// notify prints the lines dropped since the last notice
+func (d *dropCounter) notify() {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = make(map[string]uint64)
+	d.mu.Unlock()
+	pods := make([]string, 0, len(pending))
+	for pod := range pending {
+		pods = append(pods, pod)
+	}
+	sort.Strings(pods)
+	for _, pod := range pods {
+		log.Printf("%d lines dropped from pod \"%s\"", pending[pod], pod)
+	}
+}
+
+// notifyEvery prints the dropped lines periodically until stop is closed
+func (d *dropCounter) notifyEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.notify()
+		case <-stop:
+			d.notify()
+			return
+		}
+	}
+}
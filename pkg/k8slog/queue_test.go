@@ -0,0 +1,116 @@
+package k8slog
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fillQueue pushes the lines to a queue of size 2 whose consumer is stalled: the first line is taken
+// by the delivering goroutine, the next two fill the buffer
+func fillQueue(t *testing.T, out chan LogLine, policy BufferPolicy, drops *int32) *podQueue {
+	q := newPodQueue(out, 2, policy, func() { atomic.AddInt32(drops, 1) })
+	q.push(LogLine{Line: "1"})
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		q.mu.Lock()
+		size := q.size
+		q.mu.Unlock()
+		if size == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the first line wasn't taken")
+		}
+	}
+	q.push(LogLine{Line: "2"})
+	q.push(LogLine{Line: "3"})
+	return q
+}
+
+// delivered reads n lines from out
+func delivered(out chan LogLine, n int) []string {
+	var lines []string
+	for i := 0; i < n; i++ {
+		lines = append(lines, (<-out).Line)
+	}
+	return lines
+}
+
+func TestPodQueueDrop(t *testing.T) {
+	tests := []struct {
+		policy BufferPolicy
+		want   []string
+	}{
+		{policy: BufferDropOldest, want: []string{"1", "4", "5"}},
+		{policy: BufferDropNewest, want: []string{"1", "2", "3"}},
+	}
+	for _, tt := range tests {
+		out := make(chan LogLine)
+		var drops int32
+		q := fillQueue(t, out, tt.policy, &drops)
+		q.push(LogLine{Line: "4"})
+		q.push(LogLine{Line: "5"})
+		if got := delivered(out, 3); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("policy %d: delivered %q, want %q", tt.policy, got, tt.want)
+		}
+		if drops != 2 {
+			t.Errorf("policy %d: %d drops, want 2", tt.policy, drops)
+		}
+		q.close()
+	}
+}
+
+func TestPodQueueBlock(t *testing.T) {
+	out := make(chan LogLine)
+	var drops int32
+	q := fillQueue(t, out, BufferBlock, &drops)
+	pushed := make(chan struct{})
+	go func() {
+		q.push(LogLine{Line: "4"})
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push didn't block on a full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := delivered(out, 1); got[0] != "1" {
+		t.Errorf("delivered %q first", got)
+	}
+	<-pushed
+	closed := make(chan struct{})
+	go func() {
+		q.close()
+		close(closed)
+	}()
+	// close waits for the buffered lines to be delivered
+	if got := delivered(out, 3); !reflect.DeepEqual(got, []string{"2", "3", "4"}) {
+		t.Errorf("delivered %q", got)
+	}
+	<-closed
+	if drops != 0 {
+		t.Errorf("%d lines dropped", drops)
+	}
+}
+
+func TestPodQueueUnbuffered(t *testing.T) {
+	out := make(chan LogLine, 1)
+	q := newPodQueue(out, 0, BufferDropNewest, func() { t.Error("line dropped") })
+	q.push(LogLine{Line: "1"})
+	if l := <-out; l.Line != "1" {
+		t.Errorf("delivered %q", l.Line)
+	}
+	q.close()
+}
+
+func TestParseBufferPolicy(t *testing.T) {
+	for str, want := range map[string]BufferPolicy{"block": BufferBlock, "drop-oldest": BufferDropOldest, "drop-newest": BufferDropNewest} {
+		if policy, err := ParseBufferPolicy(str); err != nil || policy != want {
+			t.Errorf("ParseBufferPolicy(%q) = %d, %v", str, policy, err)
+		}
+	}
+	if _, err := ParseBufferPolicy("drop"); err == nil {
+		t.Error("ParseBufferPolicy(\"drop\") succeeded")
+	}
+}
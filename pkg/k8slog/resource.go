@@ -3,12 +3,10 @@ package k8slog
 import (
 	"bufio"
 	"io"
-	"log"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/cenkalti/backoff"
 	"github.com/nouney/k8slog/pkg/k8s"
 	"github.com/pkg/errors"
 )
@@ -22,6 +20,14 @@ type Resource interface {
 	GetLogs(*k8s.PodLogOptions) (<-chan LogLine, error)
 }
 
+// resolver is a resource which can be retrieved from kubernetes before getting its logs
+type resolver interface {
+	// resolve retrieves the resource, it fails if it doesn't exist
+	resolve() error
+	// id returns the resource string (namespace/type/name)
+	id() string
+}
+
 // NewResource creates new Resource object
 //
 // A resource can be a pod, a deployment, a statefulsets, etc.
@@ -37,30 +43,25 @@ type Resource interface {
 //	- pod, po
 //	- deployment, deploy
 func NewResource(k8s *k8s.Client, res string) (Resource, error) {
-	var err error
-	r := resource{
-		k8s:       k8s,
-		Namespace: defaultNamespace,
-		Type:      TypePod,
-	}
-	chunks := strings.Split(res, "/")
-	nbc := len(chunks)
-	if nbc == 1 {
-		// Z: the pod "Z" in namespace "default"
-		r.Name = chunks[0]
-	} else if nbc == 2 {
-		// Y/Z: all the pods of the resource "Z" of type "Y" in namespace "default"
-		r.Type, err = strTypeToConst(chunks[0])
-		r.Name = chunks[1]
-	} else if nbc == 3 {
-		// X/Y/Z: all the pods of the resource "Z" of type "Y" in namespace "X"
-		r.Namespace = chunks[0]
-		r.Type, err = strTypeToConst(chunks[1])
-		r.Name = chunks[2]
+	return New(k8s).newResource(res)
+}
+
+// newResource creates a new Resource object streaming logs with the client's settings
+func (c *Client) newResource(res string) (Resource, error) {
+	if typ, path, ok := parseSource(res); ok {
+		return c.newSource(res, typ, path), nil
 	}
+	ns, typ, name, err := ParseResource(res)
 	if err != nil {
 		return nil, err
 	}
+	r := resource{
+		k8s:       c.k8s,
+		c:         c,
+		Namespace: ns,
+		Type:      typ,
+		Name:      name,
+	}
 	return types[r.Type](r), nil
 	// var ret Resource
 	// switch r.Type {
@@ -74,13 +75,53 @@ func NewResource(k8s *k8s.Client, res string) (Resource, error) {
 	// return ret, nil
 }
 
+// ParseResource parses a resource string (see NewResource) into its namespace, type and name
+func ParseResource(res string) (string, ResourceType, string, error) {
+	var err error
+	ns, typ, name := defaultNamespace, TypePod, ""
+	chunks := strings.Split(res, "/")
+	nbc := len(chunks)
+	if nbc == 1 {
+		// Z: the pod "Z" in namespace "default"
+		name = chunks[0]
+	} else if nbc == 2 {
+		// Y/Z: all the pods of the resource "Z" of type "Y" in namespace "default"
+		typ, err = strTypeToConst(chunks[0])
+		name = chunks[1]
+	} else if nbc == 3 {
+		// X/Y/Z: all the pods of the resource "Z" of type "Y" in namespace "X"
+		ns = chunks[0]
+		typ, err = strTypeToConst(chunks[1])
+		name = chunks[2]
+	} else {
+		err = errors.Errorf("invalid resource: %s", res)
+	}
+	if err != nil {
+		return "", TypeUnknown, "", err
+	}
+	if ns == "" || name == "" {
+		return "", TypeUnknown, "", errors.Errorf("invalid resource: %s", res)
+	}
+	return ns, typ, name, nil
+}
+
 type resource struct {
 	k8s       *k8s.Client
+	c         *Client
 	Type      ResourceType
 	Namespace string
 	Name      string
 }
 
+func (r resource) id() string {
+	return r.Namespace + "/" + r.Type.String() + "/" + r.Name
+}
+
+// reportError reports an error related to a pod of the resource
+func (r resource) reportError(pod, container string, phase Phase, err error) {
+	r.c.reportError(&Error{Resource: r.id(), Pod: pod, Container: container, Phase: phase, Err: err})
+}
+
 func (r resource) getLogs(opts *k8s.PodLogOptions, selector *k8s.LabelSelector) (<-chan LogLine, error) {
 	var out chan LogLine
 	var err error
@@ -88,35 +129,98 @@ func (r resource) getLogs(opts *k8s.PodLogOptions, selector *k8s.LabelSelector)
 		out = make(chan LogLine)
 		// If we follow the log stream, we must watch the ressource's pods
 		// so we can handle new ones as they're created
-		r.watchPodsAndGetLogs(out, selector, opts)
+		r.watchPodsAndGetLogs(out, opts, func(onAdd func(*k8s.Pod), onUpdate func(*k8s.Pod, *k8s.Pod), onDelete func(*k8s.Pod)) func() {
+			return k8s.WatchPods(r.k8s, r.Namespace, selector, onAdd, onUpdate, onDelete)
+		})
 	} else {
 		out, err = r.listPodsAndGetLogs(selector, opts)
 	}
 	return out, err
 }
 
-// watchAndGetLogs watch pods matching the label selector in a specific namespace and retrieve their logs
+// podWatcher starts watching pods and returns a function to stop it
+type podWatcher func(onAdd func(*k8s.Pod), onUpdate func(*k8s.Pod, *k8s.Pod), onDelete func(*k8s.Pod)) func()
+
+// senders tracks the goroutines sending to a channel, so it's closed once they're done
+type senders struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	stopped bool
+}
+
+// add registers a new sender, it returns false once the senders are stopped
+func (s *senders) add() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return false
+	}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *senders) done() {
+	s.wg.Done()
+}
+
+// stop prevents new senders and waits for the current ones
+func (s *senders) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// watchAndGetLogs watch pods and retrieve their logs, out is closed once the logs are stopped
 //
 // Async function
-func (r resource) watchPodsAndGetLogs(out chan<- LogLine, selector *k8s.LabelSelector, opts *k8s.PodLogOptions) {
-	k8s.WatchPods(r.k8s, r.Namespace, selector,
+func (r resource) watchPodsAndGetLogs(out chan<- LogLine, opts *k8s.PodLogOptions, watch podWatcher) {
+	objs := r.involvedObjects()
+	var followers senders
+	// informer's handlers are called sequentially, no need to lock
+	trackers := make(map[string]*podTracker)
+	stopWatch := watch(
 		func(pod *k8s.Pod) {
 			// a pod matching the selector was created
-			log.Printf("new pod \"%s\"", pod.ObjectMeta.Name)
-
-			// we need a retry mechanism since the pod can take a moment to be running
-			// (image pull, init containers, etc.)
-			err := backoff.Retry(
-				func() error {
-					return r.getPodLogs(out, pod.Name, opts)
-				},
-				backoff.NewConstantBackOff(1*time.Second),
-			)
-			if err != nil {
-				log.Printf("error: %s", err.Error())
+			if !followers.add() {
 				return
 			}
-		}, nil, nil)
+			objs.addPod(pod)
+			t := newPodTracker(pod)
+			trackers[pod.Name] = t
+			go func() {
+				defer followers.done()
+				r.followPod(out, t, opts)
+			}()
+		},
+		func(_, pod *k8s.Pod) {
+			if t, ok := trackers[pod.Name]; ok {
+				t.update(pod)
+			}
+		},
+		func(pod *k8s.Pod) {
+			if t, ok := trackers[pod.Name]; ok {
+				t.delete()
+				delete(trackers, pod.Name)
+			}
+		})
+	// the existing pods are added to the objects by now, so the events of the initial list involving them are kept
+	var stopEvents []func()
+	if r.c.k8sEvents {
+		stopEvents = r.watchK8sEvents(out, objs, &followers)
+	}
+	if r.c.stop == nil {
+		return
+	}
+	go func() {
+		<-r.c.stop
+		stopWatch()
+		for _, stop := range stopEvents {
+			stop()
+		}
+		followers.stop()
+		close(out)
+	}()
 }
 
 // listPodsAndGetLogs lists pods maching the label selector in a specific namespace and retrieve their logs
@@ -130,15 +234,19 @@ func (r resource) listPodsAndGetLogs(selector *k8s.LabelSelector, opts *k8s.PodL
 	out := make(chan LogLine)
 	go func() {
 		var wg sync.WaitGroup
+		if r.c.k8sEvents {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.listK8sEvents(out, pods)
+			}()
+		}
 		wg.Add(len(pods))
-		for _, pod := range pods {
+		for i := range pods {
 			go func(pod *k8s.Pod) {
 				defer wg.Done()
-				err := r.getPodLogs(out, pod.Name, opts)
-				if err != nil {
-					log.Printf("error: %s", err.Error())
-				}
-			}(&pod)
+				r.getPodLogs(out, pod, opts)
+			}(&pods[i])
 		}
 		wg.Wait()
 		close(out)
@@ -146,32 +254,123 @@ func (r resource) listPodsAndGetLogs(selector *k8s.LabelSelector, opts *k8s.PodL
 	return out, nil
 }
 
-// getPodLogs retrieve logs of a pod
+// getPodLogs retrieve logs of all the containers of a pod
+//
+// Sync function
+func (r resource) getPodLogs(out chan<- LogLine, pod *k8s.Pod, opts *k8s.PodLogOptions) {
+	var wg sync.WaitGroup
+	wg.Add(len(pod.Spec.Containers))
+	for _, container := range pod.Spec.Containers {
+		go func(container string) {
+			defer wg.Done()
+			_, err := r.getContainerLogs(out, pod, container, opts, nil, nil)
+			if err != nil && err != errNoRequest {
+				r.reportError(pod.Name, container, PhaseStream, err)
+			}
+		}(container.Name)
+	}
+	wg.Wait()
+}
+
+// getContainerLogs retrieve logs of a container and returns the time of the last line streamed,
+// onConnect (optional) is called once the stream is open.
+//
+// Closing cancel (optional) gives up waiting for a log request slot, errNoRequest is then returned.
 //
 // Sync function
-func (r resource) getPodLogs(out chan<- LogLine, name string, opts *k8s.PodLogOptions) error {
-	rc, err := k8s.GetPodLogs(r.k8s, r.Namespace, name, opts)
+func (r resource) getContainerLogs(out chan<- LogLine, pod *k8s.Pod, container string, opts *k8s.PodLogOptions, cancel <-chan struct{}, onConnect func()) (time.Time, error) {
+	name := pod.Name
+	meta := r.podMeta(pod, container)
+	key := r.Namespace + "/" + name
+	var last time.Time
+	if opts.SinceTime != nil {
+		last = opts.SinceTime.Time
+	}
+	release, ok := r.acquireRequest(name, container, cancel)
+	if !ok {
+		return last, errNoRequest
+	}
+	defer release()
+	copts := *opts
+	copts.Container = container
+	rc, err := k8s.GetPodLogs(r.k8s, r.Namespace, name, &copts)
 	if err != nil {
-		return errors.Wrap(err, "get logs")
+		return last, errors.Wrap(err, "get logs")
+	}
+	defer rc.Close()
+	// closing the stream ends the read when the logs are stopped
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		select {
+		case <-r.c.stop:
+			rc.Close()
+		case <-closed:
+		}
+	}()
+	if onConnect != nil {
+		onConnect()
 	}
-	rdr := bufio.NewReader(rc)
+	q := newPodQueue(out, r.c.bufferSize, r.c.bufferPolicy, func() { r.c.drops.inc(key) })
 	if opts.Follow {
-		log.Printf("pod \"%s\": start streaming", name)
+		r.emit(out, LogLine{PodMeta: meta, Kind: KindContainerStarted, Pod: name, Container: container, Line: "start streaming"})
 	}
+	err = readLines(rc, func(line string) {
+		t := lineTime(line, opts.Timestamps)
+		if opts.Timestamps && opts.SinceTime != nil && !t.After(opts.SinceTime.Time) {
+			// already streamed: the API server truncates SinceTime to the second
+			return
+		}
+		last = t
+		q.push(LogLine{resource: r, PodMeta: meta, Time: t, Pod: name, Container: container, Line: line})
+	})
+	q.close()
+	if err != nil {
+		return last, errors.Wrap(err, "read")
+	}
+	if opts.Follow {
+		r.emit(out, LogLine{PodMeta: meta, Kind: KindStreamEnded, Pod: name, Container: container, Line: "end streaming"})
+	}
+	return last, nil
+}
+
+// readLines calls f for each line read until EOF
+func readLines(rd io.Reader, f func(line string)) error {
+	rdr := bufio.NewReader(rd)
 	for {
 		line, err := rdr.ReadBytes('\n')
+		if len(line) > 0 {
+			f(string(line))
+		}
 		if err == io.EOF {
-			if opts.Follow {
-				log.Printf("pod \"%s\": end streaming", name)
-			}
-			break
+			return nil
 		}
 		if err != nil {
-			return errors.Wrap(err, "read")
+			return err
 		}
-		out <- LogLine{r, name, string(line)}
 	}
-	return nil
+}
+
+// lineTime returns the timestamp of the line if it has one, otherwise the current time
+func lineTime(line string, timestamps bool) time.Time {
+	if timestamps {
+		if i := strings.IndexByte(line, ' '); i > 0 {
+			if t, err := time.Parse(time.RFC3339Nano, line[:i]); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Now()
+}
+
+// emit sends a lifecycle event of a pod, if enabled
+func (r resource) emit(out chan<- LogLine, event LogLine) {
+	if !r.c.events {
+		return
+	}
+	event.resource = r
+	event.Time = time.Now()
+	out <- event
 }
 
 // func validateResourceType(t string) (ResourceType, error) {
@@ -186,3 +385,28 @@ func (r resource) getPodLogs(out chan<- LogLine, name string, opts *k8s.PodLogOp
 // 		return TypeUnknown, fmt.Errorf("unknown resource type: %s", t)
 // 	}
 // }
+
+// acquireRequest waits for a free log request slot, the returned function releases it.
+//
+// The wait is reported with ErrMaxLogRequests, it is given up when the logs are stopped or cancel is closed.
+func (r resource) acquireRequest(pod, container string, cancel <-chan struct{}) (func(), bool) {
+	requests := r.c.requests
+	if requests == nil {
+		return func() {}, true
+	}
+	select {
+	case requests <- struct{}{}:
+	default:
+		r.reportError(pod, container, PhaseStream, errors.Wrapf(ErrMaxLogRequests, "waiting for a free slot (max %d)", r.c.maxRequests))
+		select {
+		case requests <- struct{}{}:
+		case <-r.c.stop:
+			return nil, false
+		case <-cancel:
+			return nil, false
+		}
+	}
+	return func() {
+		<-requests
+	}, true
+}
@@ -7,24 +7,36 @@ import (
 // Deployment is a deployment resource
 type Deployment struct {
 	resource
+	selector *k8s.LabelSelector
 }
 
 // GetLogs retrieve logs for the deployment resource
 //
 // This will get logs from all the pods matching the deployment selector
 func (d Deployment) GetLogs(opts *k8s.PodLogOptions) (<-chan LogLine, error) {
+	if d.selector == nil {
+		if err := d.resolve(); err != nil {
+			return nil, err
+		}
+	}
+	return d.getLogs(opts, d.selector)
+}
+
+// resolve retrieves the deployment's selector
+func (d *Deployment) resolve() error {
 	deploy, err := k8s.GetDeployment(d.k8s, d.Namespace, d.Name)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return d.getLogs(opts, deploy.Spec.Selector)
+	d.selector = deploy.Spec.Selector
+	return nil
 }
 
 func init() {
 	registerType(
 		TypeDeploy,
 		func(r resource) Resource {
-			return &Deployment{r}
+			return &Deployment{resource: r}
 		},
 		"deployment", "deploy",
 	)
@@ -1,34 +1,56 @@
 package k8slog
 
 import (
-	"log"
-
 	"github.com/nouney/k8slog/pkg/k8s"
 )
 
 // Pod is a pod resource
 type Pod struct {
 	resource
+	pod *k8s.Pod
 }
 
 // GetLogs retrieve logs for the pod resource
+//
+// If the follow option is enabled, the pod is watched so its containers are streamed again when they restart
 func (p Pod) GetLogs(opts *k8s.PodLogOptions) (<-chan LogLine, error) {
 	out := make(chan LogLine)
+	if opts.Follow {
+		p.watchPodsAndGetLogs(out, opts, func(onAdd func(*k8s.Pod), onUpdate func(*k8s.Pod, *k8s.Pod), onDelete func(*k8s.Pod)) func() {
+			return k8s.WatchPod(p.k8s, p.Namespace, p.Name, onAdd, onUpdate, onDelete)
+		})
+		return out, nil
+	}
+	if p.pod == nil {
+		if err := p.resolve(); err != nil {
+			return nil, err
+		}
+	}
 	go func() {
-		err := p.getPodLogs(out, p.Name, opts)
-		if err != nil {
-			log.Fatal(err)
+		if p.c.k8sEvents {
+			p.listK8sEvents(out, []k8s.Pod{*p.pod})
 		}
+		p.getPodLogs(out, p.pod, opts)
 		close(out)
 	}()
 	return out, nil
 }
 
+// resolve retrieves the pod
+func (p *Pod) resolve() error {
+	pod, err := k8s.GetPod(p.k8s, p.Namespace, p.Name)
+	if err != nil {
+		return err
+	}
+	p.pod = pod
+	return nil
+}
+
 func init() {
 	registerType(
 		TypePod,
 		func(r resource) Resource {
-			return &Pod{r}
+			return &Pod{resource: r}
 		},
 		"pod", "po",
 	)
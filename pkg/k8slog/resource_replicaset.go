@@ -7,24 +7,36 @@ import (
 // ReplicaSet is a ReplicaSet resource
 type ReplicaSet struct {
 	resource
+	selector *k8s.LabelSelector
 }
 
 // GetLogs retrieve logs for the ReplicaSet resource
 //
 // This will get logs from all the pods matching the ReplicaSet selector
 func (rs ReplicaSet) GetLogs(opts *k8s.PodLogOptions) (<-chan LogLine, error) {
+	if rs.selector == nil {
+		if err := rs.resolve(); err != nil {
+			return nil, err
+		}
+	}
+	return rs.getLogs(opts, rs.selector)
+}
+
+// resolve retrieves the replicaset's selector
+func (rs *ReplicaSet) resolve() error {
 	repset, err := k8s.GetReplicaSet(rs.k8s, rs.Namespace, rs.Name)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return rs.getLogs(opts, repset.Spec.Selector)
+	rs.selector = repset.Spec.Selector
+	return nil
 }
 
 func init() {
 	registerType(
 		TypeReplicaSet,
 		func(r resource) Resource {
-			return &ReplicaSet{r}
+			return &ReplicaSet{resource: r}
 		},
 		"replicaset", "rs",
 	)
@@ -8,29 +8,41 @@ import (
 // Service is a Service resource
 type Service struct {
 	resource
+	selector *k8s.LabelSelector
 }
 
 // GetLogs retrieve logs for the Service resource
 //
 // This will get logs from all the pods matching the Service selector
 func (s Service) GetLogs(opts *k8s.PodLogOptions) (<-chan LogLine, error) {
+	if s.selector == nil {
+		if err := s.resolve(); err != nil {
+			return nil, err
+		}
+	}
+	return s.getLogs(opts, s.selector)
+}
+
+// resolve retrieves the service's selector
+func (s *Service) resolve() error {
 	svc, err := k8s.GetService(s.k8s, s.Namespace, s.Name)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	selector := &k8s.LabelSelector{}
 	err = v1.Convert_map_to_unversioned_LabelSelector(&svc.Spec.Selector, selector, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return s.getLogs(opts, selector)
+	s.selector = selector
+	return nil
 }
 
 func init() {
 	registerType(
 		TypeService,
 		func(r resource) Resource {
-			return &Service{r}
+			return &Service{resource: r}
 		},
 		"service", "svc",
 	)
@@ -7,24 +7,36 @@ import (
 // StatefulSet is a statefulset resource
 type StatefulSet struct {
 	resource
+	selector *k8s.LabelSelector
 }
 
 // GetLogs retrieve logs for the statefulset resource
 //
 // This will get logs from all the pods matching the statefulset selector
 func (ss StatefulSet) GetLogs(opts *k8s.PodLogOptions) (<-chan LogLine, error) {
+	if ss.selector == nil {
+		if err := ss.resolve(); err != nil {
+			return nil, err
+		}
+	}
+	return ss.getLogs(opts, ss.selector)
+}
+
+// resolve retrieves the statefulset's selector
+func (ss *StatefulSet) resolve() error {
 	sttst, err := k8s.GetStatefulSet(ss.k8s, ss.Namespace, ss.Name)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return ss.getLogs(opts, sttst.Spec.Selector)
+	ss.selector = sttst.Spec.Selector
+	return nil
 }
 
 func init() {
 	registerType(
 		TypeStatefulSet,
 		func(r resource) Resource {
-			return &StatefulSet{r}
+			return &StatefulSet{resource: r}
 		},
 		"statefulset", "sts",
 	)
@@ -0,0 +1,107 @@
+package k8slog
+
+import (
+	"testing"
+)
+
+func TestParseResource(t *testing.T) {
+	tests := []struct {
+		res  string
+		ns   string
+		typ  ResourceType
+		name string
+		err  bool
+	}{
+		{res: "api-1", ns: "default", typ: TypePod, name: "api-1"},
+		{res: "deploy/api", ns: "default", typ: TypeDeploy, name: "api"},
+		{res: "prod/deployment/api", ns: "prod", typ: TypeDeploy, name: "api"},
+		{res: "prod/po/api-1", ns: "prod", typ: TypePod, name: "api-1"},
+		{res: "prod/rs/api-5d9c", ns: "prod", typ: TypeReplicaSet, name: "api-5d9c"},
+		{res: "prod/svc/api", ns: "prod", typ: TypeService, name: "api"},
+		{res: "prod/sts/db", ns: "prod", typ: TypeStatefulSet, name: "db"},
+		{res: "", err: true},
+		{res: "deploy/", err: true},
+		{res: "/deploy/api", err: true},
+		{res: "cronjob/backup", err: true},
+		{res: "prod/deploy/api/x", err: true},
+	}
+	for _, tt := range tests {
+		ns, typ, name, err := ParseResource(tt.res)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseResource(%q) = %s, %s, %s, want an error", tt.res, ns, typ, name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseResource(%q): %v", tt.res, err)
+			continue
+		}
+		if ns != tt.ns || typ != tt.typ || name != tt.name {
+			t.Errorf("ParseResource(%q) = %s, %s, %s, want %s, %s, %s", tt.res, ns, typ, name, tt.ns, tt.typ, tt.name)
+		}
+	}
+}
+
+func TestNewResource(t *testing.T) {
+	tests := []struct {
+		res string
+		typ ResourceType
+	}{
+		{res: "api-1", typ: TypePod},
+		{res: "prod/deploy/api", typ: TypeDeploy},
+		{res: "prod/svc/api", typ: TypeService},
+		{res: "file:/var/log/app.log", typ: TypeFile},
+		{res: "-", typ: TypeStdin},
+	}
+	for _, tt := range tests {
+		r, err := NewResource(nil, tt.res)
+		if err != nil {
+			t.Errorf("NewResource(%q): %v", tt.res, err)
+			continue
+		}
+		if typ := resourceType(r); typ != tt.typ {
+			t.Errorf("NewResource(%q) has the type %s, want %s", tt.res, typ, tt.typ)
+		}
+	}
+}
+
+// resourceType returns the type of the resource created by NewResource
+func resourceType(r Resource) ResourceType {
+	switch r := r.(type) {
+	case *Source:
+		return r.Type
+	case *Pod:
+		return r.Type
+	case *Deployment:
+		return r.Type
+	case *Service:
+		return r.Type
+	}
+	return TypeUnknown
+}
+
+func TestLogsInvalidResource(t *testing.T) {
+	tests := []struct {
+		res   string
+		error string
+	}{
+		{res: "cronjob/backup", error: "cronjob/backup: resolve: unknown resource type: cronjob"},
+		{res: "file:/nonexistent/app.log", error: "file:/nonexistent/app.log: resolve: stat /nonexistent/app.log: no such file or directory"},
+	}
+	for _, tt := range tests {
+		// the resources are resolved before Logs returns, so the errors aren't reported to the handler
+		c := New(nil, WithOptsErrorHandler(func(err *Error) {
+			t.Errorf("%s: error reported to the handler: %v", tt.res, err)
+		}))
+		_, err := c.Logs("-", tt.res)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("Logs(%q) = %v, want an *Error", tt.res, err)
+			continue
+		}
+		if e.Phase != PhaseResolve || e.Error() != tt.error {
+			t.Errorf("Logs(%q) = %q in phase %s, want %q", tt.res, e.Error(), e.Phase, tt.error)
+		}
+	}
+}
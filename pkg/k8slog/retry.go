@@ -0,0 +1,99 @@
+package k8slog
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/nouney/k8slog/pkg/k8s"
+)
+
+// RetryPolicy configures how the log streams of the watched pods are retried
+type RetryPolicy struct {
+	// InitialInterval is the delay before the first retry
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between two retries
+	MaxInterval time.Duration
+	// Multiplier is the factor applied to the delay after each retry
+	Multiplier float64
+	// Jitter randomizes the delay by +/- Jitter * delay
+	Jitter float64
+	// MaxElapsedTime is the time after which a failing stream is abandoned (0: never)
+	MaxElapsedTime time.Duration
+	// PendingTimeout is the time after which a container that can't start
+	// (e.g. ImagePullBackOff) is abandoned (0: never)
+	PendingTimeout time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy used by default
+var DefaultRetryPolicy = RetryPolicy{
+	InitialInterval: 1 * time.Second,
+	MaxInterval:     30 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.5,
+	MaxElapsedTime:  5 * time.Minute,
+	PendingTimeout:  10 * time.Minute,
+}
+
+func (p RetryPolicy) backOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = p.InitialInterval
+	b.MaxInterval = p.MaxInterval
+	b.Multiplier = p.Multiplier
+	b.RandomizationFactor = p.Jitter
+	b.MaxElapsedTime = p.MaxElapsedTime
+	b.Reset()
+	return b
+}
+
+// fatalWaitingReasons are the reasons of waiting containers that will never start without user action
+var fatalWaitingReasons = map[string]struct{}{
+	"InvalidImageName":           {},
+	"ErrImageNeverPull":          {},
+	"CreateContainerConfigError": {},
+}
+
+// containerStatus returns the status of a container of the pod, nil if unknown
+func containerStatus(pod *k8s.Pod, container string) *k8s.ContainerStatus {
+	for i := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[i].Name == container {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+	return nil
+}
+
+// hasStarted returns true if the container has logs to stream
+func hasStarted(status *k8s.ContainerStatus) bool {
+	return status != nil && (status.State.Running != nil || status.State.Terminated != nil)
+}
+
+// giveUpReason returns why the logs of a container will never be available, empty if they might be
+func giveUpReason(pod *k8s.Pod, status *k8s.ContainerStatus) string {
+	if pod.Status.Phase == k8s.PodFailed && pod.Status.Reason == "Evicted" {
+		return fmt.Sprintf("pod evicted: %s", pod.Status.Message)
+	}
+	if hasStarted(status) {
+		return ""
+	}
+	if pod.Status.Phase == k8s.PodFailed || pod.Status.Phase == k8s.PodSucceeded {
+		return fmt.Sprintf("pod %s and container never started", pod.Status.Phase)
+	}
+	if status != nil && status.State.Waiting != nil {
+		if _, ok := fatalWaitingReasons[status.State.Waiting.Reason]; ok {
+			return fmt.Sprintf("%s: %s", status.State.Waiting.Reason, status.State.Waiting.Message)
+		}
+	}
+	return ""
+}
+
+// waitingReason returns why the container is not started yet
+func waitingReason(status *k8s.ContainerStatus) string {
+	if status == nil || status.State.Waiting == nil {
+		return "pending"
+	}
+	if status.State.Waiting.Message != "" {
+		return fmt.Sprintf("%s: %s", status.State.Waiting.Reason, status.State.Waiting.Message)
+	}
+	return status.State.Waiting.Reason
+}
@@ -0,0 +1,142 @@
+package k8slog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sessionVersion is the version of the session format
+const sessionVersion = 1
+
+// ErrInvalidSession is returned when a session file can't be read
+var ErrInvalidSession = errors.New("invalid session")
+
+// sessionHeader is the first line of a session
+type sessionHeader struct {
+	Version   int       `json:"k8slogSession"`
+	Resources []string  `json:"resources"`
+	Started   time.Time `json:"started"`
+}
+
+// Recorder writes the log lines of a session, one JSON object per line
+//
+// Lines are recorded as received from kubernetes, before the JSON fields are extracted,
+// so a replay can use other fields.
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder creates a new Recorder writing a session of the given resources to w
+func NewRecorder(w io.Writer, ress ...string) (*Recorder, error) {
+	enc := json.NewEncoder(w)
+	err := enc.Encode(sessionHeader{Version: sessionVersion, Resources: ress, Started: time.Now()})
+	if err != nil {
+		return nil, errors.Wrap(err, "record")
+	}
+	return &Recorder{enc: enc}, nil
+}
+
+// record writes a line, only the first error is kept
+func (r *Recorder) record(line *LogLine) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if err := r.enc.Encode(line); err != nil {
+		r.err = errors.Wrap(err, "record")
+	}
+}
+
+// Err returns the first error which occurred while recording
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// WithOptsRecorder records all the log lines and events to the recorder (default: none)
+func WithOptsRecorder(r *Recorder) Opts {
+	return func(c *Client) {
+		c.recorder = r
+	}
+}
+
+// Session is a recorded session
+type Session struct {
+	// Resources are the resources given to Logs
+	Resources []string
+	// Started is when the recording started
+	Started time.Time
+	// Lines are the recorded lines, sorted by time
+	Lines []LogLine
+}
+
+// ReadSession reads a session written by a Recorder
+func ReadSession(rd io.Reader) (*Session, error) {
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrap(err, "read session")
+		}
+		return nil, errors.Wrap(ErrInvalidSession, "empty file")
+	}
+	var header sessionHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version == 0 {
+		return nil, errors.Wrap(ErrInvalidSession, "missing header")
+	}
+	if header.Version > sessionVersion {
+		return nil, errors.Wrapf(ErrInvalidSession, "unsupported version %d", header.Version)
+	}
+	s := &Session{Resources: header.Resources, Started: header.Started}
+	for n := 2; scanner.Scan(); n++ {
+		var line LogLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, errors.Wrapf(ErrInvalidSession, "line %d: %s", n, err)
+		}
+		s.Lines = append(s.Lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read session")
+	}
+	// lines of different pods are recorded in the order they were received
+	sort.SliceStable(s.Lines, func(i, j int) bool {
+		return s.Lines[i].Time.Before(s.Lines[j].Time)
+	})
+	return s, nil
+}
+
+// Replay sends the lines of a session as if they were retrieved by Logs
+//
+// The lines are sent at the original pace multiplied by speed, or as fast as possible if speed is 0.
+// The pipeline applies, like the JSON fields option.
+func (c Client) Replay(s *Session, speed float64) <-chan LogLine {
+	out := make(chan LogLine)
+	go func() {
+		defer close(out)
+		var last time.Time
+		for _, line := range s.Lines {
+			if speed > 0 && !last.IsZero() && line.Time.After(last) {
+				time.Sleep(time.Duration(float64(line.Time.Sub(last)) / speed))
+			}
+			if !line.Time.IsZero() {
+				last = line.Time
+			}
+			c.redact(&line)
+			if !c.process(line.id(), &line) {
+				continue
+			}
+			out <- line
+		}
+	}()
+	return out
+}
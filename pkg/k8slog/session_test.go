@@ -0,0 +1,80 @@
+package k8slog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// maskRedactor masks the word "secret"
+type maskRedactor struct{}
+
+func (maskRedactor) Redact(s string) string {
+	return strings.Replace(s, "secret", "***", -1)
+}
+
+func (r maskRedactor) Process(l *LogLine) bool {
+	l.SetMessage(r.Redact(l.Message()))
+	return true
+}
+
+func TestRecordRedacted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k8slog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(path, []byte("password=secret\nhello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	recorder, err := NewRecorder(&buffer, "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(nil, WithOptsRecorder(recorder), WithOptsRedactor(maskRedactor{}), WithOptsTimestamps(false))
+	out, err := c.Logs("file:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var printed []string
+	for l := range out {
+		printed = append(printed, l.Message())
+	}
+	if want := []string{"password=***", "hello"}; strings.Join(printed, ",") != strings.Join(want, ",") {
+		t.Errorf("printed %q, want %q", printed, want)
+	}
+	if strings.Contains(buffer.String(), "secret") {
+		t.Errorf("the session recorded the secret: %s", buffer.String())
+	}
+	session, err := ReadSession(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Lines) != 2 || session.Lines[0].Message() != "password=***" {
+		t.Errorf("recorded %+v", session.Lines)
+	}
+}
+
+func TestRedactK8sEvent(t *testing.T) {
+	c := New(nil, WithOptsRedactor(maskRedactor{}))
+	l := LogLine{
+		Kind:  KindK8sEvent,
+		Event: &K8sEvent{Type: "Warning", Reason: "Failed", Message: "pull secret invalid"},
+		Line:  "Warning Failed: pull secret invalid\n",
+	}
+	c.redact(&l)
+	if l.Event.Message != "pull *** invalid" || l.Message() != "Warning Failed: pull *** invalid" {
+		t.Errorf("event not masked: %q, %q", l.Event.Message, l.Line)
+	}
+	// the lifecycle events are left as is
+	l = LogLine{Kind: KindPodDeleted, Line: "pod secret-1 deleted\n"}
+	c.redact(&l)
+	if l.Line != "pod secret-1 deleted\n" {
+		t.Errorf("lifecycle event masked: %q", l.Line)
+	}
+}
@@ -0,0 +1,211 @@
+package k8slog
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Sink is an output of the log lines: the terminal, files, a remote server, etc.
+type Sink interface {
+	// Write writes a log line or event, a sink ignores the kinds it doesn't handle
+	Write(line LogLine) error
+	// Flush writes the buffered lines, if any
+	Flush() error
+	// Close flushes and releases the sink
+	Close() error
+}
+
+// Filter selects the lines written to a sink
+type Filter func(line *LogLine) bool
+
+// SinkErrorHandler is called when a sink fails
+type SinkErrorHandler func(sink string, err error)
+
+// logSinkError prints the error with the standard logger
+func logSinkError(sink string, err error) {
+	log.Printf("sink %s: %s", sink, err)
+}
+
+// FanOut dispatches the log lines to several sinks.
+//
+// Each sink has its own filter, buffer and goroutine, so a slow or broken sink doesn't stall the others:
+// its errors are reported to the error handler and, once its buffer is full, lines are handled according
+// to its buffer policy.
+type FanOut struct {
+	outputs []*output
+	onError SinkErrorHandler
+	drops   *dropCounter
+}
+
+// output is a sink of a FanOut
+type output struct {
+	name    string
+	sink    Sink
+	filter  Filter
+	format  func(line *LogLine) string
+	queue   *podQueue
+	lines   chan LogLine
+	flushes chan chan error
+	done    chan struct{}
+	// err is the first error of the sink, set by run
+	err error
+}
+
+// SinkOpts is an option used to configure a sink of a FanOut
+type SinkOpts func(o *sinkOptions)
+
+type sinkOptions struct {
+	filter Filter
+	format func(line *LogLine) string
+	size   int
+	policy BufferPolicy
+}
+
+// WithSinkOptsFilter only writes the lines selected by the filter to the sink (default: all the lines)
+func WithSinkOptsFilter(filter Filter) SinkOpts {
+	return func(o *sinkOptions) {
+		o.filter = filter
+	}
+}
+
+// WithSinkOptsFormat replaces the message of the log lines written to the sink by the result of format,
+// the timestamp is kept (default: the message is unchanged).
+//
+// Sinks read the message with LogLine.Message, or the whole LogLine.Line. The events are left as they are.
+func WithSinkOptsFormat(format func(line *LogLine) string) SinkOpts {
+	return func(o *sinkOptions) {
+		o.format = format
+	}
+}
+
+// WithSinkOptsBuffer configures the buffer of the sink (default: 1024 lines, BufferDropOldest).
+//
+// With BufferBlock, a slow sink stalls the others once its buffer is full.
+func WithSinkOptsBuffer(size int, policy BufferPolicy) SinkOpts {
+	return func(o *sinkOptions) {
+		o.size = size
+		o.policy = policy
+	}
+}
+
+// NewFanOut creates a new FanOut, errors are reported to the handler (nil: print with the standard logger)
+func NewFanOut(onError SinkErrorHandler) *FanOut {
+	if onError == nil {
+		onError = logSinkError
+	}
+	return &FanOut{onError: onError, drops: newDropCounter()}
+}
+
+// Add adds a sink, named in the errors. Sinks must be added before the first Write.
+func (f *FanOut) Add(name string, sink Sink, opts ...SinkOpts) {
+	o := sinkOptions{size: defaultBufferSize, policy: BufferDropOldest}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	out := &output{
+		name:    name,
+		sink:    sink,
+		filter:  o.filter,
+		format:  o.format,
+		lines:   make(chan LogLine),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+	}
+	out.queue = newPodQueue(out.lines, o.size, o.policy, func() { f.drops.inc(name) })
+	f.outputs = append(f.outputs, out)
+	go out.run(f.onError)
+}
+
+// run writes the lines to the sink until the lines channel is closed
+func (o *output) run(onError SinkErrorHandler) {
+	defer close(o.done)
+	for {
+		select {
+		case line, ok := <-o.lines:
+			if !ok {
+				return
+			}
+			// formatted by the sink's goroutine, so a slow format only delays this sink
+			if o.format != nil && line.Kind == KindLog {
+				line.SetMessage(strings.TrimSuffix(o.format(&line), "\n"))
+			}
+			if err := o.sink.Write(line); err != nil {
+				o.fail(err)
+				onError(o.name, err)
+			}
+		case res := <-o.flushes:
+			err := o.sink.Flush()
+			o.fail(err)
+			res <- err
+		}
+	}
+}
+
+// fail records the first error of the sink
+func (o *output) fail(err error) {
+	if o.err == nil && err != nil {
+		o.err = errors.Wrap(err, o.name)
+	}
+}
+
+// Write dispatches the line to the sinks whose filter selects it
+func (f *FanOut) Write(line LogLine) {
+	for _, o := range f.outputs {
+		if o.filter == nil || o.filter(&line) {
+			o.queue.push(line)
+		}
+	}
+}
+
+// Run dispatches the lines until the channel is closed
+func (f *FanOut) Run(in <-chan LogLine) {
+	for line := range in {
+		f.Write(line)
+	}
+}
+
+// Flush flushes all the sinks, the lines written before are not necessarily written by the sinks yet
+func (f *FanOut) Flush() {
+	for _, o := range f.outputs {
+		res := make(chan error)
+		o.flushes <- res
+		if err := <-res; err != nil {
+			f.onError(o.name, err)
+		}
+	}
+}
+
+// Close writes the buffered lines and closes all the sinks.
+//
+// It returns the first error of the sinks, if any: a Close error, which isn't reported to the error handler,
+// or else the first Write or Flush error.
+func (f *FanOut) Close() error {
+	var wg sync.WaitGroup
+	wg.Add(len(f.outputs))
+	for _, o := range f.outputs {
+		go func(o *output) {
+			defer wg.Done()
+			o.queue.close()
+			close(o.lines)
+			<-o.done
+			if err := o.sink.Close(); err != nil {
+				o.err = errors.Wrap(err, o.name)
+			}
+		}(o)
+	}
+	wg.Wait()
+	for _, o := range f.outputs {
+		if o.err != nil {
+			return o.err
+		}
+	}
+	return nil
+}
+
+// Dropped returns the number of lines dropped per sink because of full buffers
+func (f *FanOut) Dropped() map[string]uint64 {
+	return f.drops.snapshot()
+}
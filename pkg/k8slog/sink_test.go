@@ -0,0 +1,116 @@
+package k8slog
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// memSink keeps the lines written
+type memSink struct {
+	mu       sync.Mutex
+	lines    []string
+	writeErr error
+	closeErr error
+	closed   bool
+}
+
+func (s *memSink) Write(l LogLine) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, l.Line)
+	return s.writeErr
+}
+
+func (s *memSink) Flush() error {
+	return nil
+}
+
+func (s *memSink) Close() error {
+	s.closed = true
+	return s.closeErr
+}
+
+func TestFanOut(t *testing.T) {
+	all, filtered := &memSink{}, &memSink{}
+	var reported []string
+	f := NewFanOut(func(sink string, err error) {
+		reported = append(reported, sink)
+	})
+	f.Add("all", all, WithSinkOptsBuffer(0, BufferBlock))
+	f.Add("filtered", filtered, WithSinkOptsFilter(func(l *LogLine) bool { return l.Kind == KindLog }))
+	f.Write(LogLine{Kind: KindLog, Line: "a"})
+	f.Write(LogLine{Kind: KindPodAdded, Line: "new pod"})
+	f.Write(LogLine{Kind: KindLog, Line: "b"})
+	f.Flush()
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(all.lines) != 3 {
+		t.Errorf("all = %v, want 3 lines", all.lines)
+	}
+	if len(filtered.lines) != 2 || filtered.lines[0] != "a" || filtered.lines[1] != "b" {
+		t.Errorf("filtered = %v, want [a b]", filtered.lines)
+	}
+	if !all.closed || !filtered.closed {
+		t.Error("the sinks should be closed")
+	}
+	if len(reported) != 0 {
+		t.Errorf("errors reported for %v", reported)
+	}
+}
+
+func TestFanOutErrors(t *testing.T) {
+	failing := &memSink{writeErr: errors.New("write failed")}
+	var reported []string
+	f := NewFanOut(func(sink string, err error) {
+		reported = append(reported, sink+": "+err.Error())
+	})
+	f.Add("ok", &memSink{})
+	f.Add("failing", failing)
+	f.Write(LogLine{Line: "a"})
+	f.Write(LogLine{Line: "b"})
+	err := f.Close()
+	if err == nil || err.Error() != "failing: write failed" {
+		t.Errorf("Close() = %v, want the first write error", err)
+	}
+	if len(reported) != 2 {
+		t.Errorf("reported = %v, want the 2 write errors", reported)
+	}
+
+	// a close error is returned rather than reported
+	reported = nil
+	f = NewFanOut(func(sink string, err error) {
+		reported = append(reported, sink)
+	})
+	f.Add("push", &memSink{closeErr: errors.New("final push failed")})
+	if err := f.Close(); err == nil || err.Error() != "push: final push failed" {
+		t.Errorf("Close() = %v, want the close error", err)
+	}
+	if len(reported) != 0 {
+		t.Errorf("errors reported for %v", reported)
+	}
+}
+
+func TestFanOutFormat(t *testing.T) {
+	raw, formatted := &memSink{}, &memSink{}
+	f := NewFanOut(nil)
+	f.Add("raw", raw)
+	f.Add("formatted", formatted, WithSinkOptsFormat(func(l *LogLine) string {
+		return l.Pod + ": " + l.Message() + "\n"
+	}))
+	f.Write(LogLine{Kind: KindLog, Pod: "api-1", Line: "2024-01-02T03:04:05Z hello\n"})
+	f.Write(LogLine{Kind: KindLog, Pod: "api-1", Line: "no timestamp\n"})
+	f.Write(LogLine{Kind: KindPodAdded, Pod: "api-2", Line: "new pod"})
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2024-01-02T03:04:05Z hello\n", "no timestamp\n", "new pod"}; !reflect.DeepEqual(raw.lines, want) {
+		t.Errorf("raw = %q, want %q", raw.lines, want)
+	}
+	// the timestamp is kept and the events aren't formatted
+	if want := []string{"2024-01-02T03:04:05Z api-1: hello\n", "api-1: no timestamp\n", "new pod"}; !reflect.DeepEqual(formatted.lines, want) {
+		t.Errorf("formatted = %q, want %q", formatted.lines, want)
+	}
+}
@@ -0,0 +1,208 @@
+package k8slog
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nouney/k8slog/pkg/k8s"
+	"github.com/pkg/errors"
+)
+
+const (
+	// localNamespace is the namespace of the lines of local sources whose namespace is unknown
+	localNamespace = "local"
+	// followInterval is the delay between two reads at the end of a followed file
+	followInterval = 500 * time.Millisecond
+)
+
+// sourceSchemes are the prefixes of the resource strings reading logs from a local source
+var sourceSchemes = map[string]ResourceType{
+	"file:":  TypeFile,
+	"cri:":   TypeCRI,
+	"stdin:": TypeStdin,
+}
+
+// parseSource parses a local source: "file:PATH", "cri:PATH", "stdin:" or "-" for the standard input
+func parseSource(res string) (ResourceType, string, bool) {
+	if res == "-" {
+		return TypeStdin, "", true
+	}
+	for scheme, typ := range sourceSchemes {
+		if strings.HasPrefix(res, scheme) {
+			return typ, strings.TrimPrefix(res, scheme), true
+		}
+	}
+	return TypeUnknown, "", false
+}
+
+// IsLocal returns true if the resource string is a local source, which doesn't need a cluster
+func IsLocal(res string) bool {
+	_, _, ok := parseSource(res)
+	return ok
+}
+
+// Source is a local source of logs: a file or the standard input.
+//
+// The lines go through the same processing as the logs of the cluster.
+type Source struct {
+	resource
+	res       string
+	path      string
+	pod       string
+	container string
+}
+
+// newSource creates a local source, the pod and container are guessed from the path of CRI log files
+func (c *Client) newSource(res string, typ ResourceType, path string) Resource {
+	s := &Source{
+		resource: resource{c: c, Type: typ, Namespace: localNamespace, Name: filepath.Base(path)},
+		res:      res,
+		path:     path,
+		pod:      strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+	}
+	switch typ {
+	case TypeStdin:
+		s.Name = "stdin"
+		s.pod = "stdin"
+	case TypeCRI:
+		if ns, pod, container, ok := parseCRIPath(path); ok {
+			s.Namespace, s.pod, s.container = ns, pod, container
+		}
+	}
+	return s
+}
+
+// parseCRIPath extracts the namespace, pod and container from the path of a container log file:
+//	- /var/log/pods/NAMESPACE_POD_UID/CONTAINER/N.log
+//	- /var/log/containers/POD_NAMESPACE_CONTAINER-ID.log
+func parseCRIPath(path string) (string, string, string, bool) {
+	path = filepath.ToSlash(path)
+	chunks := strings.Split(path, "/")
+	if n := len(chunks); n >= 3 {
+		if parts := strings.Split(chunks[n-3], "_"); len(parts) == 3 {
+			return parts[0], parts[1], chunks[n-2], true
+		}
+	}
+	name := strings.TrimSuffix(chunks[len(chunks)-1], ".log")
+	if parts := strings.Split(name, "_"); len(parts) == 3 {
+		if i := strings.LastIndex(parts[2], "-"); i > 0 {
+			return parts[1], parts[0], parts[2][:i], true
+		}
+	}
+	return "", "", "", false
+}
+
+func (s *Source) id() string {
+	return s.res
+}
+
+// resolve checks the file exists
+func (s *Source) resolve() error {
+	if s.Type == TypeStdin {
+		return nil
+	}
+	_, err := os.Stat(s.path)
+	return err
+}
+
+// GetLogs reads the logs of the source
+//
+// If the follow option is enabled, files are read like tail -f.
+func (s *Source) GetLogs(opts *k8s.PodLogOptions) (<-chan LogLine, error) {
+	var rd io.ReadCloser = os.Stdin
+	if s.Type != TypeStdin {
+		file, err := os.Open(s.path)
+		if err != nil {
+			return nil, err
+		}
+		rd = file
+		if opts.Follow {
+			rd = followReader{file, s.c.stop}
+		}
+	}
+	out := make(chan LogLine)
+	go func() {
+		defer close(out)
+		defer rd.Close()
+		parse := s.parseLine
+		if s.Type == TypeCRI {
+			parse = s.criParser(opts.Timestamps)
+		}
+		err := readLines(rd, func(line string) {
+			if l, ok := parse(line); ok {
+				out <- l
+			}
+		})
+		if err != nil {
+			s.c.reportError(&Error{Resource: s.id(), Phase: PhaseStream, Err: errors.Wrap(err, "read")})
+		}
+	}()
+	return out, nil
+}
+
+// parseLine parses a line of kubectl logs, with or without timestamp
+func (s *Source) parseLine(line string) (LogLine, bool) {
+	return LogLine{resource: s.resource, Time: lineTime(line, true), Pod: s.pod, Container: s.container, Line: line}, true
+}
+
+// criParser returns a function parsing the lines of a CRI log file: "TIMESTAMP STREAM TAG MESSAGE".
+//
+// Partial lines (tag P) are joined with the next ones, the timestamp is kept if timestamps are enabled,
+// like kubectl logs --timestamps.
+func (s *Source) criParser(timestamps bool) func(line string) (LogLine, bool) {
+	var partial strings.Builder
+	return func(line string) (LogLine, bool) {
+		fields := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 4)
+		if len(fields) < 3 {
+			// not in the CRI format, keep it as is
+			return s.parseLine(line)
+		}
+		t, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return s.parseLine(line)
+		}
+		msg := ""
+		if len(fields) == 4 {
+			msg = fields[3]
+		}
+		partial.WriteString(msg)
+		if fields[2] == "P" {
+			return LogLine{}, false
+		}
+		msg = partial.String() + "\n"
+		partial.Reset()
+		if timestamps {
+			msg = fields[0] + " " + msg
+		}
+		return LogLine{resource: s.resource, Time: t, Pod: s.pod, Container: s.container, Stream: fields[1], Line: msg}, true
+	}
+}
+
+// followReader reads a file like tail -f: at the end of the file, it waits for new data until stop is closed
+type followReader struct {
+	*os.File
+	stop <-chan struct{}
+}
+
+func (f followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := f.File.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		select {
+		case <-time.After(followInterval):
+		case <-f.stop:
+			return 0, io.EOF
+		}
+	}
+}
+
+func init() {
+	typeNames[TypeFile] = "file"
+	typeNames[TypeCRI] = "cri"
+	typeNames[TypeStdin] = "stdin"
+}
@@ -0,0 +1,113 @@
+package k8slog
+
+import (
+	"testing"
+)
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		res  string
+		typ  ResourceType
+		path string
+		ok   bool
+	}{
+		{res: "-", typ: TypeStdin, ok: true},
+		{res: "stdin:", typ: TypeStdin, ok: true},
+		{res: "file:app.log", typ: TypeFile, path: "app.log", ok: true},
+		{res: "cri:/var/log/pods/prod_api_123/app/0.log", typ: TypeCRI, path: "/var/log/pods/prod_api_123/app/0.log", ok: true},
+		{res: "prod/deploy/api", typ: TypeUnknown},
+		{res: "api-abcd", typ: TypeUnknown},
+	}
+	for _, tt := range tests {
+		typ, path, ok := parseSource(tt.res)
+		if typ != tt.typ || path != tt.path || ok != tt.ok {
+			t.Errorf("parseSource(%q) = %v, %q, %v, want %v, %q, %v", tt.res, typ, path, ok, tt.typ, tt.path, tt.ok)
+		}
+	}
+}
+
+func TestParseCRIPath(t *testing.T) {
+	tests := []struct {
+		path               string
+		ns, pod, container string
+		ok                 bool
+	}{
+		{path: "/var/log/pods/prod_api-7d9f8b6c4-x2k9p_0c5a/app/0.log", ns: "prod", pod: "api-7d9f8b6c4-x2k9p", container: "app", ok: true},
+		{path: "prod_api-abcd_uid/app/3.log", ns: "prod", pod: "api-abcd", container: "app", ok: true},
+		{path: "/var/log/containers/api-abcd_prod_app-0123456789abcdef.log", ns: "prod", pod: "api-abcd", container: "app", ok: true},
+		{path: "/var/log/containers/api-abcd_prod_my-app-0123456789abcdef.log", ns: "prod", pod: "api-abcd", container: "my-app", ok: true},
+		{path: "/tmp/app.log"},
+		{path: "0.log"},
+	}
+	for _, tt := range tests {
+		ns, pod, container, ok := parseCRIPath(tt.path)
+		if ns != tt.ns || pod != tt.pod || container != tt.container || ok != tt.ok {
+			t.Errorf("parseCRIPath(%q) = %q, %q, %q, %v, want %q, %q, %q, %v",
+				tt.path, ns, pod, container, ok, tt.ns, tt.pod, tt.container, tt.ok)
+		}
+	}
+}
+
+func TestCRIParser(t *testing.T) {
+	c := New(nil)
+	s := c.newSource("cri:/var/log/pods/prod_api-abcd_uid/app/0.log", TypeCRI, "/var/log/pods/prod_api-abcd_uid/app/0.log").(*Source)
+	if s.Name != "0.log" || s.Namespace != "prod" || s.pod != "api-abcd" || s.container != "app" {
+		t.Fatalf("source = %s/%s %s/%s", s.Namespace, s.Name, s.pod, s.container)
+	}
+	tests := []struct {
+		timestamps bool
+		lines      []string
+		want       []string
+		streams    []string
+	}{
+		{
+			lines:   []string{"2024-05-01T10:00:00.123456789Z stdout F hello world\n"},
+			want:    []string{"hello world\n"},
+			streams: []string{"stdout"},
+		},
+		{
+			timestamps: true,
+			lines:      []string{"2024-05-01T10:00:00.123456789Z stderr F oops\n"},
+			want:       []string{"2024-05-01T10:00:00.123456789Z oops\n"},
+			streams:    []string{"stderr"},
+		},
+		{
+			// partial lines are joined
+			lines: []string{
+				"2024-05-01T10:00:00Z stdout P a very ",
+				"2024-05-01T10:00:00Z stdout P long ",
+				"2024-05-01T10:00:01Z stdout F line\n",
+				"2024-05-01T10:00:02Z stdout F\n",
+			},
+			want:    []string{"a very long line\n", "\n"},
+			streams: []string{"stdout", "stdout"},
+		},
+		{
+			// lines which aren't in the CRI format are kept as is
+			lines:   []string{"not a cri line\n", "2024-05-01 stdout F bad timestamp\n"},
+			want:    []string{"not a cri line\n", "2024-05-01 stdout F bad timestamp\n"},
+			streams: []string{"", ""},
+		},
+	}
+	for _, tt := range tests {
+		parse := s.criParser(tt.timestamps)
+		var got []LogLine
+		for _, line := range tt.lines {
+			if l, ok := parse(line); ok {
+				got = append(got, l)
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %d lines, want %d", tt.lines, len(got), len(tt.want))
+			continue
+		}
+		for i, l := range got {
+			if l.Line != tt.want[i] || l.Stream != tt.streams[i] {
+				t.Errorf("%q: line %d = %q (%s), want %q (%s)", tt.lines, i, l.Line, l.Stream, tt.want[i], tt.streams[i])
+			}
+			if l.Pod != "api-abcd" || l.Container != "app" {
+				t.Errorf("%q: line %d of %s/%s", tt.lines, i, l.Pod, l.Container)
+			}
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package k8slog
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CollapseMode is how consecutive repeated lines of a container are collapsed
+type CollapseMode int
+
+const (
+	// CollapseNone prints all the lines
+	CollapseNone CollapseMode = iota
+	// CollapseExact collapses the identical lines
+	CollapseExact
+	// CollapseNormalized collapses the lines which only differ by their numbers, hexadecimal IDs and UUIDs
+	CollapseNormalized
+)
+
+const (
+	// throttleInterval is the interval between two notices of repeated or suppressed lines, and the rate limit window
+	throttleInterval = time.Second
+	// throttleIdle is the time after which the state of a silent container or pod is forgotten
+	throttleIdle = time.Minute
+)
+
+// variablePart matches the parts of a line ignored by CollapseNormalized
+var variablePart = regexp.MustCompile(`[0-9a-fA-F]{8}(?:-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}|\b[0-9a-fA-F]*[0-9][0-9a-fA-F]*\b|\d+`)
+
+// ParseCollapseMode converts a string (none, exact, normalized) to a CollapseMode
+func ParseCollapseMode(str string) (CollapseMode, error) {
+	switch str {
+	case "none":
+		return CollapseNone, nil
+	case "exact":
+		return CollapseExact, nil
+	case "normalized":
+		return CollapseNormalized, nil
+	default:
+		return CollapseNone, fmt.Errorf("unknown collapse mode: %s", str)
+	}
+}
+
+// WithOptsCollapse configures the collapsing of consecutive repeated lines of a container (default: CollapseNone).
+//
+// The repeated lines are replaced by a line "last message repeated N times", printed when another line
+// is received or every second.
+func WithOptsCollapse(mode CollapseMode) Opts {
+	return func(c *Client) {
+		c.collapse = mode
+	}
+}
+
+// WithOptsLineRate configures the maximum number of lines per second of a pod, 0 for unlimited (default: 0).
+//
+// Lines above the limit are suppressed and counted in a line "N lines suppressed", printed every second.
+func WithOptsLineRate(linesPerSecond int) Opts {
+	return func(c *Client) {
+		c.lineRate = linesPerSecond
+	}
+}
+
+// throttle collapses the repeated lines and limits the rate of the lines of a resource's pods
+type throttle struct {
+	collapse CollapseMode
+	rate     int
+	// repeats are the last lines of the containers (namespace/pod/container)
+	repeats map[string]*repeat
+	// windows are the rate limit windows of the pods (namespace/pod)
+	windows map[string]*window
+}
+
+// repeat is the last line of a container and the number of times it was repeated since the last notice
+type repeat struct {
+	line     LogLine
+	key      string
+	count    uint64
+	lastSeen time.Time
+}
+
+// window counts the lines of a pod since the start of the window
+type window struct {
+	line       LogLine
+	start      time.Time
+	lines      int
+	suppressed uint64
+	lastSeen   time.Time
+}
+
+func newThrottle(collapse CollapseMode, rate int) *throttle {
+	return &throttle{
+		collapse: collapse,
+		rate:     rate,
+		repeats:  make(map[string]*repeat),
+		windows:  make(map[string]*window),
+	}
+}
+
+// push sends the line to out unless it's repeated or above the rate limit
+func (t *throttle) push(out chan<- LogLine, line LogLine) {
+	stream := line.Namespace + "/" + line.Pod + "/" + line.Container
+	pod := line.Namespace + "/" + line.Pod
+	if line.Kind != KindLog {
+		// the repeats are printed before the container's events
+		if r, ok := t.repeats[stream]; ok {
+			t.notifyRepeat(out, r)
+		}
+		switch line.Kind {
+		case KindStreamEnded:
+			delete(t.repeats, stream)
+		case KindPodDeleted:
+			t.notifyWindow(out, pod)
+			delete(t.windows, pod)
+		}
+		out <- line
+		return
+	}
+	if t.collapse != CollapseNone {
+		key := line.Message()
+		if t.collapse == CollapseNormalized {
+			key = variablePart.ReplaceAllString(key, "#")
+		}
+		r, ok := t.repeats[stream]
+		if ok && r.key == key {
+			r.count++
+			r.line = line
+			r.lastSeen = time.Now()
+			return
+		}
+		if ok {
+			t.notifyRepeat(out, r)
+		}
+		t.repeats[stream] = &repeat{line: line, key: key, lastSeen: time.Now()}
+	}
+	if t.rate > 0 {
+		w, ok := t.windows[pod]
+		if !ok {
+			w = &window{start: time.Now()}
+			t.windows[pod] = w
+		} else if time.Since(w.start) >= throttleInterval {
+			t.notifyWindow(out, pod)
+			w.start = time.Now()
+			w.lines = 0
+		}
+		w.lines++
+		w.lastSeen = time.Now()
+		if w.lines > t.rate {
+			w.suppressed++
+			w.line = line
+			return
+		}
+	}
+	out <- line
+}
+
+// flush prints the pending notices, sorted by container and pod, and forgets the idle containers and pods.
+//
+// The lifecycle events also clean the state up, but they may be disabled.
+func (t *throttle) flush(out chan<- LogLine) {
+	streams := make([]string, 0, len(t.repeats))
+	for stream := range t.repeats {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+	for _, stream := range streams {
+		r := t.repeats[stream]
+		t.notifyRepeat(out, r)
+		if time.Since(r.lastSeen) >= throttleIdle {
+			delete(t.repeats, stream)
+		}
+	}
+	pods := make([]string, 0, len(t.windows))
+	for pod := range t.windows {
+		pods = append(pods, pod)
+	}
+	sort.Strings(pods)
+	for _, pod := range pods {
+		t.notifyWindow(out, pod)
+		if time.Since(t.windows[pod].lastSeen) >= throttleIdle {
+			delete(t.windows, pod)
+		}
+	}
+}
+
+// notifyRepeat prints the number of times the last line was repeated, if any
+func (t *throttle) notifyRepeat(out chan<- LogLine, r *repeat) {
+	if r.count == 0 {
+		return
+	}
+	msg := fmt.Sprintf("last message repeated %d times", r.count)
+	if t.collapse == CollapseNormalized {
+		msg = fmt.Sprintf("similar message repeated %d times", r.count)
+	}
+	out <- t.notice(r.line, msg)
+	r.count = 0
+}
+
+// notifyWindow prints the number of lines of the pod suppressed by the rate limit, if any
+func (t *throttle) notifyWindow(out chan<- LogLine, pod string) {
+	w := t.windows[pod]
+	if w == nil || w.suppressed == 0 {
+		return
+	}
+	out <- t.notice(w.line, fmt.Sprintf("%d lines suppressed (more than %d lines/s)", w.suppressed, t.rate))
+	w.suppressed = 0
+}
+
+// notice returns a log line of the same container as l with the given message, timestamped if l is
+func (t *throttle) notice(l LogLine, msg string) LogLine {
+	n := LogLine{
+		resource:  l.resource,
+		PodMeta:   l.PodMeta,
+		Kind:      KindLog,
+		Time:      time.Now(),
+		Pod:       l.Pod,
+		Container: l.Container,
+		Stream:    l.Stream,
+		Line:      msg + "\n",
+	}
+	if l.Message() != strings.TrimSuffix(l.Line, "\n") {
+		n.Line = n.Time.UTC().Format(time.RFC3339Nano) + " " + n.Line
+	}
+	return n
+}
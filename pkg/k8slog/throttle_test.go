@@ -0,0 +1,140 @@
+package k8slog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// podLine returns a log line of the container app of a pod of the namespace prod
+func podLine(pod, msg string) LogLine {
+	return LogLine{resource: resource{Namespace: "prod"}, Pod: pod, Container: "app", Line: msg + "\n"}
+}
+
+// received returns the pod and message of the lines sent to out
+func received(out chan LogLine) []string {
+	var lines []string
+	for {
+		select {
+		case l := <-out:
+			lines = append(lines, l.Pod+": "+l.Message())
+		default:
+			return lines
+		}
+	}
+}
+
+func TestThrottleCollapse(t *testing.T) {
+	tests := []struct {
+		mode CollapseMode
+		in   []string
+		want []string
+	}{
+		{
+			mode: CollapseExact,
+			in:   []string{"retry 1", "retry 1", "retry 1", "retry 2", "done"},
+			want: []string{"a: retry 1", "a: last message repeated 2 times", "a: retry 2", "a: done"},
+		},
+		{
+			mode: CollapseNormalized,
+			in:   []string{"retry 1", "retry 2", "id 0a1b2c3d", "id 9f8e7d6c", "done"},
+			want: []string{"a: retry 1", "a: similar message repeated 1 times", "a: id 0a1b2c3d", "a: similar message repeated 1 times", "a: done"},
+		},
+		{
+			// the repeats pending when the input ends are printed by flush
+			mode: CollapseExact,
+			in:   []string{"tick", "tick", "tick"},
+			want: []string{"a: tick", "a: last message repeated 2 times"},
+		},
+	}
+	for _, tt := range tests {
+		out := make(chan LogLine, 100)
+		th := newThrottle(tt.mode, 0)
+		for _, msg := range tt.in {
+			th.push(out, podLine("a", msg))
+		}
+		th.flush(out)
+		if got := received(out); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestThrottleRate(t *testing.T) {
+	out := make(chan LogLine, 100)
+	th := newThrottle(CollapseNone, 2)
+	for _, msg := range []string{"1", "2", "3", "4"} {
+		th.push(out, podLine("a", msg))
+	}
+	th.push(out, podLine("b", "1"))
+	th.flush(out)
+	want := []string{"a: 1", "a: 2", "b: 1", "a: 2 lines suppressed (more than 2 lines/s)"}
+	if got := received(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// a new window starts after the interval
+	th.windows["prod/a"].start = time.Now().Add(-throttleInterval)
+	th.push(out, podLine("a", "5"))
+	if got := received(out); !reflect.DeepEqual(got, []string{"a: 5"}) {
+		t.Errorf("got %q after the window", got)
+	}
+}
+
+func TestThrottleFlush(t *testing.T) {
+	out := make(chan LogLine, 100)
+	th := newThrottle(CollapseExact, 1)
+	for _, pod := range []string{"d", "b", "c", "a"} {
+		th.push(out, podLine(pod, "x"))
+		th.push(out, podLine(pod, "x"))
+		th.push(out, podLine(pod, "y"))
+	}
+	received(out)
+	for _, pod := range []string{"c", "a", "d", "b"} {
+		th.push(out, podLine(pod, "y"))
+	}
+	th.flush(out)
+	// the repeats are printed sorted by container, then the suppressed lines sorted by pod
+	want := []string{
+		"a: last message repeated 1 times", "b: last message repeated 1 times",
+		"c: last message repeated 1 times", "d: last message repeated 1 times",
+		"a: 1 lines suppressed (more than 1 lines/s)", "b: 1 lines suppressed (more than 1 lines/s)",
+		"c: 1 lines suppressed (more than 1 lines/s)", "d: 1 lines suppressed (more than 1 lines/s)",
+	}
+	if got := received(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestThrottleEvict(t *testing.T) {
+	out := make(chan LogLine, 100)
+	th := newThrottle(CollapseExact, 10)
+	th.push(out, podLine("a", "x"))
+	th.push(out, podLine("b", "x"))
+	th.push(out, podLine("b", "x"))
+	th.flush(out)
+	if len(th.repeats) != 2 || len(th.windows) != 2 {
+		t.Fatalf("forgot active pods: %d repeats, %d windows", len(th.repeats), len(th.windows))
+	}
+	// without lifecycle events, the idle pods are only forgotten by flush
+	th.repeats["prod/a/app"].lastSeen = time.Now().Add(-throttleIdle)
+	th.windows["prod/a"].lastSeen = time.Now().Add(-throttleIdle)
+	th.push(out, podLine("b", "x"))
+	th.flush(out)
+	if _, ok := th.repeats["prod/a/app"]; ok || len(th.repeats) != 1 {
+		t.Errorf("repeats not evicted: %v", th.repeats)
+	}
+	if _, ok := th.windows["prod/a"]; ok || len(th.windows) != 1 {
+		t.Errorf("windows not evicted: %v", th.windows)
+	}
+	received(out)
+	// the pending notice of an idle pod is printed before it's forgotten
+	th.push(out, podLine("b", "x"))
+	th.repeats["prod/b/app"].lastSeen = time.Now().Add(-throttleIdle)
+	th.flush(out)
+	if got := received(out); !reflect.DeepEqual(got, []string{"b: last message repeated 1 times"}) {
+		t.Errorf("got %q", got)
+	}
+	if len(th.repeats) != 0 {
+		t.Errorf("repeats not evicted: %v", th.repeats)
+	}
+}
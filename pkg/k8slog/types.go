@@ -18,13 +18,28 @@ const (
 	TypeReplicaSet
 	// TypeService is the resource type for services
 	TypeService
+	// TypeFile is a local file containing the output of kubectl logs
+	TypeFile
+	// TypeCRI is a local container log file in the CRI format (/var/log/pods/...)
+	TypeCRI
+	// TypeStdin is the standard input, containing the output of kubectl logs
+	TypeStdin
 
-	lastType = TypeService + 1
+	lastType = TypeStdin + 1
 )
 
 var types [lastType]func(resource) Resource
+var typeNames [lastType]string
 var strTypes map[string]ResourceType
 
+// String returns the name of the resource type
+func (t ResourceType) String() string {
+	if t <= TypeUnknown || t >= lastType {
+		return "unknown"
+	}
+	return typeNames[t]
+}
+
 func strTypeToConst(str string) (ResourceType, error) {
 	c, ok := strTypes[str]
 	if !ok || c == TypeUnknown {
@@ -33,11 +48,22 @@ func strTypeToConst(str string) (ResourceType, error) {
 	return c, nil
 }
 
+// typeFromName returns the resource type with the given name (see String), TypeUnknown if none
+func typeFromName(name string) ResourceType {
+	for typ, n := range typeNames {
+		if n == name && ResourceType(typ) != TypeUnknown {
+			return ResourceType(typ)
+		}
+	}
+	return TypeUnknown
+}
+
 func registerType(typ ResourceType, f func(resource) Resource, strs ...string) {
 	if strTypes == nil {
 		strTypes = make(map[string]ResourceType)
 	}
 	types[typ] = f
+	typeNames[typ] = strs[0]
 	for _, str := range strs {
 		strTypes[str] = typ
 	}
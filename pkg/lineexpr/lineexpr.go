@@ -0,0 +1,234 @@
+// Package lineexpr filters and transforms log lines with expressions (https://expr-lang.org)
+package lineexpr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/nouney/k8slog/pkg/k8slog"
+	"github.com/pkg/errors"
+)
+
+// assignment matches "target = expression"
+var assignment = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)\s*=([^=].*)$`)
+
+// variables are the variables of the environment, with the type checked when compiling.
+//
+// The fields of JSON lines are also variables, unless they have the name of one of these.
+var variables = map[string]interface{}{
+	"line":        "",
+	"namespace":   "",
+	"resource":    "",
+	"pod":         "",
+	"container":   "",
+	"stream":      "",
+	"time":        time.Time{},
+	"fields":      map[string]interface{}{},
+	"labels":      map[string]string{},
+	"annotations": map[string]string{},
+	"node":        "",
+	"ip":          "",
+	"owner":       "",
+	"image":       "",
+	"restarts":    0,
+}
+
+// Env returns the environment of the expressions for a log line:
+//	- line: the message, without timestamp
+//	- namespace, resource, pod, container, stream and time
+//	- fields: the fields of JSON lines (see k8slog.JSONParser), which are also variables, e.g. level
+//	- labels, annotations, node, ip, owner, image and restarts: the pod metadata, if enabled
+func Env(l *k8slog.LogLine) map[string]interface{} {
+	env := make(map[string]interface{}, len(variables)+len(l.Fields))
+	for key, value := range l.Fields {
+		env[key] = value
+	}
+	fields := l.Fields
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	env["line"] = l.Message()
+	env["namespace"] = l.Namespace
+	env["resource"] = l.Name
+	env["pod"] = l.Pod
+	env["container"] = l.Container
+	env["stream"] = l.Stream
+	env["time"] = l.Time
+	env["fields"] = fields
+	meta := l.PodMeta
+	if meta == nil {
+		meta = &k8slog.PodMeta{}
+	}
+	env["labels"] = meta.Labels
+	env["annotations"] = meta.Annotations
+	env["node"] = meta.Node
+	env["ip"] = meta.PodIP
+	env["owner"] = meta.Owner
+	env["image"] = meta.Image
+	env["restarts"] = int(meta.RestartCount)
+	return env
+}
+
+// compile compiles an expression, undefined variables (e.g. missing fields) are nil
+func compile(src string, opts ...expr.Option) (*vm.Program, error) {
+	opts = append([]expr.Option{expr.Env(variables), expr.AllowUndefinedVariables()}, opts...)
+	program, err := expr.Compile(src, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid expression %q", src)
+	}
+	return program, nil
+}
+
+// Filter is a k8slog.Processor dropping the lines for which a boolean expression is false.
+//
+// The lines for which the evaluation fails, e.g. comparing a missing field, are dropped as well.
+// Use ?? to give a default value: (duration_ms ?? 0) > 1000.
+type Filter struct {
+	program *vm.Program
+}
+
+// NewFilter compiles a filter, e.g. level == "error" || duration_ms > 1000
+func NewFilter(src string) (*Filter, error) {
+	program, err := compile(src, expr.AsBool())
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{program: program}, nil
+}
+
+// Process implements k8slog.Processor
+func (f *Filter) Process(l *k8slog.LogLine) bool {
+	return f.eval(Env(l))
+}
+
+// eval evaluates the filter in the environment of a line
+func (f *Filter) eval(env map[string]interface{}) bool {
+	out, err := expr.Run(f.program, env)
+	if err != nil {
+		return false
+	}
+	return out.(bool)
+}
+
+// Setter is a k8slog.Processor assigning the value of an expression to a field of the lines.
+//
+// The target line replaces the message, other targets are fields of the JSON lines, which are re-encoded
+// with their keys sorted. The lines for which the evaluation fails are left unchanged.
+type Setter struct {
+	target  string
+	program *vm.Program
+}
+
+// NewSetter compiles an assignment: target = expression, e.g. msg = upper(msg)
+func NewSetter(src string) (*Setter, error) {
+	chunks := assignment.FindStringSubmatch(src)
+	if chunks == nil {
+		return nil, fmt.Errorf("invalid assignment, must be field = expression: %s", src)
+	}
+	program, err := compile(chunks[2])
+	if err != nil {
+		return nil, err
+	}
+	return &Setter{target: chunks[1], program: program}, nil
+}
+
+// Process implements k8slog.Processor
+func (s *Setter) Process(l *k8slog.LogLine) bool {
+	s.eval(l, Env(l))
+	return true
+}
+
+// eval evaluates the assignment in the environment of a line, which is updated with the new value
+func (s *Setter) eval(l *k8slog.LogLine, env map[string]interface{}) {
+	if s.target != "line" && l.Fields == nil {
+		return
+	}
+	out, err := expr.Run(s.program, env)
+	if err != nil {
+		return
+	}
+	if s.target == "line" {
+		l.SetMessage(fmt.Sprint(out))
+		env["line"] = l.Message()
+		return
+	}
+	l.Fields[s.target] = out
+	if _, ok := variables[s.target]; !ok {
+		env[s.target] = out
+	}
+	var buffer bytes.Buffer
+	enc := json.NewEncoder(&buffer)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(l.Fields); err != nil {
+		return
+	}
+	l.SetMessage(string(bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))))
+	env["line"] = l.Message()
+}
+
+// Filters is a k8slog.Processor dropping the lines for which one of the filters is false,
+// the environment of each line is built once for all of them
+type Filters []*Filter
+
+// Process implements k8slog.Processor
+func (fs Filters) Process(l *k8slog.LogLine) bool {
+	if len(fs) == 0 {
+		return true
+	}
+	env := Env(l)
+	for _, f := range fs {
+		if !f.eval(env) {
+			return false
+		}
+	}
+	return true
+}
+
+// Setters is a k8slog.Processor running the setters in order, each seeing the values written by the previous ones:
+// the environment of each line is built once for all of them
+type Setters []*Setter
+
+// Process implements k8slog.Processor
+func (ss Setters) Process(l *k8slog.LogLine) bool {
+	if len(ss) == 0 {
+		return true
+	}
+	env := Env(l)
+	for _, s := range ss {
+		s.eval(l, env)
+	}
+	return true
+}
+
+// Program is the filters and the setters of the lines, to add to the filter and the transform stages of the pipeline
+type Program struct {
+	// Filters are the filters, for k8slog.StageFilter
+	Filters Filters
+	// Setters are the setters, for k8slog.StageTransform
+	Setters Setters
+}
+
+// New compiles the filters and the setters of a program
+func New(filters, setters []string) (*Program, error) {
+	p := &Program{}
+	for _, src := range filters {
+		filter, err := NewFilter(src)
+		if err != nil {
+			return nil, err
+		}
+		p.Filters = append(p.Filters, filter)
+	}
+	for _, src := range setters {
+		setter, err := NewSetter(src)
+		if err != nil {
+			return nil, err
+		}
+		p.Setters = append(p.Setters, setter)
+	}
+	return p, nil
+}
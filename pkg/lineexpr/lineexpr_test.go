@@ -0,0 +1,174 @@
+package lineexpr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+const jsonLine = `{"duration_ms":1500,"level":"error","msg":"timeout","path":"/api"}`
+
+// logLine returns a parsed line of the pod api-1 of the deployment prod/api
+func logLine(msg string) *k8slog.LogLine {
+	var l k8slog.LogLine
+	l.Namespace = "prod"
+	l.Type = k8slog.TypeDeploy
+	l.Name = "api"
+	l.Pod = "api-1"
+	l.Container = "app"
+	l.Line = "2024-01-02T03:04:05.000000006Z " + msg + "\n"
+	k8slog.JSONParser.Process(&l)
+	return &l
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		src  string
+		msg  string
+		want bool
+	}{
+		{src: `level == "error"`, msg: jsonLine, want: true},
+		{src: `level == "info"`, msg: jsonLine, want: false},
+		{src: `duration_ms > 1000 && pod == "api-1"`, msg: jsonLine, want: true},
+		{src: `fields.path startsWith "/api"`, msg: jsonLine, want: true},
+		{src: `namespace == "prod" && resource == "api" && container == "app"`, msg: jsonLine, want: true},
+		{src: `line contains "panic"`, msg: "panic: nil map", want: true},
+		// a missing field fails the evaluation, unless it has a default
+		{src: `status > 400`, msg: jsonLine, want: false},
+		{src: `(status ?? 500) > 400`, msg: jsonLine, want: true},
+		{src: `level == nil`, msg: "plain text", want: true},
+	}
+	for _, tt := range tests {
+		filter, err := NewFilter(tt.src)
+		if err != nil {
+			t.Fatalf("NewFilter(%q): %v", tt.src, err)
+		}
+		if got := filter.Process(logLine(tt.msg)); got != tt.want {
+			t.Errorf("%q on %q = %v, want %v", tt.src, tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestSetter(t *testing.T) {
+	tests := []struct {
+		src  string
+		msg  string
+		want string
+	}{
+		{src: `msg = upper(msg)`, msg: jsonLine, want: `{"duration_ms":1500,"level":"error","msg":"TIMEOUT","path":"/api"}`},
+		{src: `pod = pod`, msg: `{"b":1,"a":"<x>"}`, want: `{"a":"<x>","b":1,"pod":"api-1"}`},
+		{src: `line = pod + ": " + line`, msg: "hello", want: "api-1: hello"},
+		// fields of plain lines and failed evaluations leave the line unchanged
+		{src: `msg = "x"`, msg: "plain text", want: "plain text"},
+		{src: `msg = status + 1`, msg: jsonLine, want: jsonLine},
+	}
+	for _, tt := range tests {
+		setter, err := NewSetter(tt.src)
+		if err != nil {
+			t.Fatalf("NewSetter(%q): %v", tt.src, err)
+		}
+		l := logLine(tt.msg)
+		setter.Process(l)
+		if got := l.Message(); got != tt.want {
+			t.Errorf("%q on %q = %q, want %q", tt.src, tt.msg, got, tt.want)
+		}
+		if !strings.HasPrefix(l.Line, "2024-01-02T03:04:05.000000006Z ") {
+			t.Errorf("%q dropped the timestamp: %q", tt.src, l.Line)
+		}
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	for _, src := range []string{`level ==`, `1 + 2`, `line contains`} {
+		if _, err := NewFilter(src); err == nil {
+			t.Errorf("NewFilter(%q) succeeded", src)
+		}
+	}
+	for _, src := range []string{`msg == 1`, `= 1`, `msg`, `1msg = 2`, `msg = (`} {
+		if _, err := NewSetter(src); err == nil {
+			t.Errorf("NewSetter(%q) succeeded", src)
+		}
+	}
+}
+
+func TestProgram(t *testing.T) {
+	program, err := New(
+		[]string{`level == "error"`},
+		[]string{`msg = upper(msg)`, `short = msg[:3]`, `line = "[" + short + "] " + line`},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the filters run in the filter stage, before the setters of the transform stage
+	pipeline := k8slog.NewPipeline().
+		Add(k8slog.StageTransform, program.Setters).
+		Add(k8slog.StageFilter, program.Filters)
+	if pipeline.Process(logLine(`{"level":"info","msg":"ok"}`)) {
+		t.Error("the line of level info wasn't dropped")
+	}
+	l := logLine(`{"level":"error","msg":"timeout"}`)
+	if !pipeline.Process(l) {
+		t.Fatal("the line of level error was dropped")
+	}
+	// the setters see the values written by the previous ones
+	want := `[TIM] {"level":"error","msg":"TIMEOUT","short":"TIM"}`
+	if got := l.Message(); got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+	if _, err := New([]string{`level ==`}, nil); err == nil {
+		t.Error("New succeeded with an invalid filter")
+	}
+	if _, err := New(nil, []string{`msg`}); err == nil {
+		t.Error("New succeeded with an invalid setter")
+	}
+}
+
+func BenchmarkJSONParser(b *testing.B) {
+	l := logLine(jsonLine)
+	for i := 0; i < b.N; i++ {
+		l.Fields = nil
+		k8slog.JSONParser.Process(l)
+	}
+}
+
+func BenchmarkFilter(b *testing.B) {
+	filter, err := NewFilter(`level == "error" || (duration_ms ?? 0) > 1000`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	l := logLine(jsonLine)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filter.Process(l)
+	}
+}
+
+func BenchmarkSetter(b *testing.B) {
+	setter, err := NewSetter(`path = lower(path)`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	l := logLine(jsonLine)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		setter.Process(l)
+	}
+}
+
+func BenchmarkProgram(b *testing.B) {
+	program, err := New(
+		[]string{`level == "error"`, `(duration_ms ?? 0) > 1000`, `path != "/healthz"`},
+		[]string{`path = lower(path)`},
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	l := logLine(jsonLine)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if program.Filters.Process(l) {
+			program.Setters.Process(l)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package loki pushes log lines to Grafana Loki
+package loki
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nouney/k8slog/pkg/batch"
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+const (
+	// pushPath is the path of Loki's push API
+	pushPath = "/loki/api/v1/push"
+	// defaultBatchSize is the default number of lines per push
+	defaultBatchSize = 1000
+	// defaultBatchWait is the default maximum time a line waits before being pushed
+	defaultBatchWait = time.Second
+	// defaultRetryTimeout is the default time after which a failing push is abandoned
+	defaultRetryTimeout = time.Minute
+)
+
+// Sink pushes the log lines to Loki's push API, in batches.
+//
+// Lines are pushed without their timestamp, which is the time of the entry. Each container is a Loki stream labelled with namespace, resource, pod and container,
+// plus the static labels. Only the log lines are pushed, not the events.
+// The batches are pushed one at a time, so the lines of a stream reach Loki in order.
+type Sink struct {
+	url          string
+	client       *http.Client
+	labels       map[string]string
+	tenant       string
+	user         string
+	password     string
+	batchSize    int
+	batchWait    time.Duration
+	retryTimeout time.Duration
+	batcher      *batch.Batcher
+}
+
+// Opts is an option used to configure Sink
+type Opts func(s *Sink)
+
+// WithOptsLabels adds static labels to all the streams, e.g. job=k8slog (default: none)
+func WithOptsLabels(labels map[string]string) Opts {
+	return func(s *Sink) {
+		for k, v := range labels {
+			s.labels[k] = v
+		}
+	}
+}
+
+// WithOptsTenant sets the tenant of a multi-tenant Loki, sent in the X-Scope-OrgID header (default: none)
+func WithOptsTenant(tenant string) Opts {
+	return func(s *Sink) {
+		s.tenant = tenant
+	}
+}
+
+// WithOptsBasicAuth authenticates the pushes with HTTP basic authentication (default: none)
+func WithOptsBasicAuth(user, password string) Opts {
+	return func(s *Sink) {
+		s.user = user
+		s.password = password
+	}
+}
+
+// WithOptsBatch configures the batches (default: 1000 lines, 1s).
+//
+// A batch is pushed when it has size lines or its oldest line waited for wait.
+func WithOptsBatch(size int, wait time.Duration) Opts {
+	return func(s *Sink) {
+		s.batchSize = size
+		s.batchWait = wait
+	}
+}
+
+// WithOptsRetryTimeout configures the time after which a failing push is abandoned (default: 1m).
+//
+// Failing pushes are retried with an exponential backoff, except if Loki rejects them (4xx errors but 429).
+func WithOptsRetryTimeout(timeout time.Duration) Opts {
+	return func(s *Sink) {
+		s.retryTimeout = timeout
+	}
+}
+
+// WithOptsHTTPClient configures the HTTP client used to push (default: http.DefaultClient)
+func WithOptsHTTPClient(client *http.Client) Opts {
+	return func(s *Sink) {
+		s.client = client
+	}
+}
+
+// New creates a new Sink pushing to the Loki at the given URL, e.g. http://localhost:3100
+func New(url string, opts ...Opts) (*Sink, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("invalid loki url: %s", url)
+	}
+	s := &Sink{
+		url:          strings.TrimSuffix(url, "/") + pushPath,
+		client:       http.DefaultClient,
+		labels:       make(map[string]string),
+		batchSize:    defaultBatchSize,
+		batchWait:    defaultBatchWait,
+		retryTimeout: defaultRetryTimeout,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.batcher = batch.New(
+		func() batch.Batch { return &pushBatch{sink: s, streams: make(map[string]*stream)} },
+		batch.HTTPSender(s.client, s.url, s.prepare, retryable),
+		batch.WithOptsBatch(s.batchSize, s.batchWait),
+		batch.WithOptsRetryTimeout(s.retryTimeout),
+	)
+	return s, nil
+}
+
+// stream is a Loki stream of the push API
+type stream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// pushRequest is the body of the push API
+type pushRequest struct {
+	Streams []*stream `json:"streams"`
+}
+
+// pushBatch is a batch of lines, grouped by stream
+type pushBatch struct {
+	sink    *Sink
+	streams map[string]*stream
+	size    int
+}
+
+func (b *pushBatch) Add(l *k8slog.LogLine) {
+	t := l.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	key := l.Namespace + "/" + l.Pod + "/" + l.Container
+	st, ok := b.streams[key]
+	if !ok {
+		st = &stream{Stream: b.sink.streamLabels(l)}
+		b.streams[key] = st
+	}
+	st.Values = append(st.Values, [2]string{strconv.FormatInt(t.UnixNano(), 10), l.Message()})
+	b.size++
+}
+
+func (b *pushBatch) Len() int {
+	return b.size
+}
+
+func (b *pushBatch) Encode() ([]byte, error) {
+	req := pushRequest{Streams: make([]*stream, 0, len(b.streams))}
+	for _, st := range b.streams {
+		// Loki may reject out of order lines within a stream
+		sort.SliceStable(st.Values, func(i, j int) bool {
+			return len(st.Values[i][0]) < len(st.Values[j][0]) ||
+				len(st.Values[i][0]) == len(st.Values[j][0]) && st.Values[i][0] < st.Values[j][0]
+		})
+		req.Streams = append(req.Streams, st)
+	}
+	return json.Marshal(&req)
+}
+
+// Write adds the line to the batch, it returns the error of the last pushes, if any
+func (s *Sink) Write(l k8slog.LogLine) error {
+	if l.Kind != k8slog.KindLog {
+		return nil
+	}
+	return s.batcher.Write(&l)
+}
+
+// streamLabels returns the labels of the line's stream
+func (s *Sink) streamLabels(l *k8slog.LogLine) map[string]string {
+	labels := map[string]string{
+		"namespace": l.Namespace,
+		"resource":  l.Type.String() + "/" + l.Name,
+		"pod":       l.Pod,
+	}
+	if l.Container != "" {
+		labels["container"] = l.Container
+	}
+	for k, v := range s.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// Flush pushes the current batch and waits for the pushes to end
+func (s *Sink) Flush() error {
+	return s.batcher.Flush()
+}
+
+// prepare sets the tenant and the credentials of a push request
+func (s *Sink) prepare(req *http.Request) {
+	if s.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", s.tenant)
+	}
+	if s.user != "" {
+		req.SetBasicAuth(s.user, s.password)
+	}
+}
+
+// retryable returns true if a push failing with the status can be retried: Loki rejects the others
+func retryable(status int) bool {
+	return status/100 != 4 || status == http.StatusTooManyRequests
+}
+
+// Close pushes the remaining lines, it returns the error of the last pushes, if any
+func (s *Sink) Close() error {
+	return s.batcher.Close()
+}
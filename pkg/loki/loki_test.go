@@ -0,0 +1,126 @@
+package loki
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+// fakeLoki is a local stand-in of Loki's push API
+type fakeLoki struct {
+	mu     sync.Mutex
+	pushes []pushRequest
+}
+
+func (f *fakeLoki) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path != pushPath || r.Header.Get("X-Scope-OrgID") != "team-a" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var req pushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.pushes = append(f.pushes, req)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func logLine(pod, msg string, t time.Time) k8slog.LogLine {
+	var l k8slog.LogLine
+	l.Namespace = "prod"
+	l.Type = k8slog.TypeDeploy
+	l.Name = "api"
+	l.Kind = k8slog.KindLog
+	l.Pod = pod
+	l.Container = "app"
+	l.Time = t
+	l.Line = t.Format(time.RFC3339Nano) + " " + msg + "\n"
+	return l
+}
+
+func newTestSink(t *testing.T, f *fakeLoki, size int) (*Sink, func()) {
+	ts := httptest.NewServer(f)
+	s, err := New(ts.URL,
+		WithOptsLabels(map[string]string{"job": "k8slog"}),
+		WithOptsTenant("team-a"),
+		WithOptsBatch(size, 0),
+		WithOptsRetryTimeout(10*time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, ts.Close
+}
+
+func TestPush(t *testing.T) {
+	f := &fakeLoki{}
+	s, stop := newTestSink(t, f, 2)
+	defer stop()
+	now := time.Now()
+	lines := []k8slog.LogLine{
+		logLine("api-1", "first", now),
+		logLine("api-2", "second", now.Add(time.Millisecond)),
+		logLine("api-1", "third", now.Add(2*time.Millisecond)),
+	}
+	for _, l := range lines {
+		if err := s.Write(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// events aren't pushed
+	event := logLine("api-1", "new pod", now)
+	event.Kind = k8slog.KindPodAdded
+	s.Write(event)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.pushes) != 2 {
+		t.Fatalf("%d pushes, want 2 batches", len(f.pushes))
+	}
+	first := f.pushes[0].Streams
+	if len(first) != 2 {
+		t.Fatalf("first push has %d streams, want 2", len(first))
+	}
+	for _, st := range first {
+		labels := st.Stream
+		if labels["namespace"] != "prod" || labels["resource"] != "deployment/api" || labels["container"] != "app" || labels["job"] != "k8slog" {
+			t.Errorf("labels = %v", labels)
+		}
+		if len(st.Values) != 1 {
+			t.Errorf("stream %s has %d values, want 1", labels["pod"], len(st.Values))
+		}
+	}
+	last := f.pushes[1].Streams
+	if len(last) != 1 || last[0].Stream["pod"] != "api-1" || last[0].Values[0][1] != "third" {
+		t.Errorf("last push = %+v", last)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for status, want := range map[int]bool{
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusServiceUnavailable:  true,
+	} {
+		if got := retryable(status); got != want {
+			t.Errorf("retryable(%d) = %t, want %t", status, got, want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("localhost:3100"); err == nil {
+		t.Error("New should reject an url without scheme")
+	}
+}
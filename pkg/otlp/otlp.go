@@ -0,0 +1,311 @@
+// Package otlp exports log lines as OpenTelemetry log records over OTLP/HTTP
+package otlp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nouney/k8slog/pkg/batch"
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+const (
+	// DefaultEndpoint is the default OTLP/HTTP logs endpoint of a local collector
+	DefaultEndpoint = "http://localhost:4318/v1/logs"
+	// scopeName is the instrumentation scope of the records
+	scopeName = "github.com/nouney/k8slog"
+	// defaultBatchSize is the default number of records per export
+	defaultBatchSize = 512
+	// defaultBatchWait is the default maximum time a record waits before being exported
+	defaultBatchWait = time.Second
+	// defaultRetryTimeout is the default time after which a failing export is abandoned
+	defaultRetryTimeout = time.Minute
+)
+
+// severityNumbers are the OpenTelemetry severity numbers of the levels
+var severityNumbers = map[k8slog.Level]int{
+	k8slog.LevelTrace: 1,
+	k8slog.LevelDebug: 5,
+	k8slog.LevelInfo:  9,
+	k8slog.LevelWarn:  13,
+	k8slog.LevelError: 17,
+	k8slog.LevelFatal: 21,
+}
+
+// resourceAttributes are the attributes of the workload of each resource type
+var resourceAttributes = map[k8slog.ResourceType]string{
+	k8slog.TypeDeploy:      "k8s.deployment.name",
+	k8slog.TypeStatefulSet: "k8s.statefulset.name",
+	k8slog.TypeReplicaSet:  "k8s.replicaset.name",
+}
+
+// ownerAttributes are the attributes of the workload of each kind of pod controller (see k8slog.PodMeta.Owner)
+var ownerAttributes = map[string]string{
+	"replicaset":  "k8s.replicaset.name",
+	"statefulset": "k8s.statefulset.name",
+	"daemonset":   "k8s.daemonset.name",
+	"job":         "k8s.job.name",
+}
+
+// Exporter exports the log lines to an OTLP/HTTP endpoint, in batches.
+//
+// Each container is an OpenTelemetry resource with the k8s.* attributes, the records have
+// the timestamp of the kubernetes log line and the severity detected from its content.
+// Only the log lines are exported, not the events.
+type Exporter struct {
+	endpoint     string
+	client       *http.Client
+	headers      map[string]string
+	batchSize    int
+	batchWait    time.Duration
+	retryTimeout time.Duration
+	batcher      *batch.Batcher
+}
+
+// Opts is an option used to configure Exporter
+type Opts func(e *Exporter)
+
+// WithOptsHeaders adds headers to the requests, e.g. for authentication (default: none)
+func WithOptsHeaders(headers map[string]string) Opts {
+	return func(e *Exporter) {
+		for k, v := range headers {
+			e.headers[k] = v
+		}
+	}
+}
+
+// WithOptsBatch configures the batches (default: 512 records, 1s).
+//
+// A batch is exported when it has size records or its oldest record waited for wait.
+func WithOptsBatch(size int, wait time.Duration) Opts {
+	return func(e *Exporter) {
+		e.batchSize = size
+		e.batchWait = wait
+	}
+}
+
+// WithOptsRetryTimeout configures the time after which a failing export is abandoned (default: 1m).
+//
+// Failing exports are retried with an exponential backoff, as described by the OTLP specification.
+func WithOptsRetryTimeout(timeout time.Duration) Opts {
+	return func(e *Exporter) {
+		e.retryTimeout = timeout
+	}
+}
+
+// WithOptsHTTPClient configures the HTTP client used to export (default: http.DefaultClient)
+func WithOptsHTTPClient(client *http.Client) Opts {
+	return func(e *Exporter) {
+		e.client = client
+	}
+}
+
+// New creates a new Exporter sending to the given logs endpoint, e.g. DefaultEndpoint
+func New(endpoint string, opts ...Opts) (*Exporter, error) {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("invalid otlp endpoint: %s", endpoint)
+	}
+	e := &Exporter{
+		endpoint:     endpoint,
+		client:       http.DefaultClient,
+		headers:      make(map[string]string),
+		batchSize:    defaultBatchSize,
+		batchWait:    defaultBatchWait,
+		retryTimeout: defaultRetryTimeout,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.batcher = batch.New(
+		func() batch.Batch { return &exportBatch{resourceLogs: make(map[string]*resourceLogs)} },
+		batch.HTTPSender(e.client, e.endpoint, e.prepare, retryable),
+		batch.WithOptsBatch(e.batchSize, e.batchWait),
+		batch.WithOptsRetryTimeout(e.retryTimeout),
+	)
+	return e, nil
+}
+
+// the types below are the JSON encoding of the OTLP protobuf messages
+
+type exportRequest struct {
+	ResourceLogs []*resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeLogs struct {
+	Scope      scope       `json:"scope"`
+	LogRecords []logRecord `json:"logRecords"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type logRecord struct {
+	TimeUnixNano         string     `json:"timeUnixNano"`
+	ObservedTimeUnixNano string     `json:"observedTimeUnixNano"`
+	SeverityNumber       int        `json:"severityNumber,omitempty"`
+	SeverityText         string     `json:"severityText,omitempty"`
+	Body                 anyValue   `json:"body"`
+	Attributes           []keyValue `json:"attributes,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func attribute(key, value string) keyValue {
+	return keyValue{Key: key, Value: anyValue{StringValue: value}}
+}
+
+// Write adds the line to the batch, it returns the error of the last exports, if any
+func (e *Exporter) Write(l k8slog.LogLine) error {
+	if l.Kind != k8slog.KindLog {
+		return nil
+	}
+	return e.batcher.Write(&l)
+}
+
+// exportBatch is a batch of records, grouped by container
+type exportBatch struct {
+	resourceLogs map[string]*resourceLogs
+	size         int
+}
+
+func (b *exportBatch) Add(l *k8slog.LogLine) {
+	now := time.Now()
+	t := l.Time
+	if t.IsZero() {
+		t = now
+	}
+	msg := l.Message()
+	record := logRecord{
+		TimeUnixNano:         strconv.FormatInt(t.UnixNano(), 10),
+		ObservedTimeUnixNano: strconv.FormatInt(now.UnixNano(), 10),
+		Body:                 anyValue{StringValue: msg},
+	}
+	if level := k8slog.DetectLevel(msg); level != k8slog.LevelUnknown {
+		record.SeverityNumber = severityNumbers[level]
+		record.SeverityText = strings.ToUpper(level.String())
+	}
+	if l.Stream != "" {
+		record.Attributes = []keyValue{attribute("log.iostream", l.Stream)}
+	}
+	key := l.Namespace + "/" + l.Pod + "/" + l.Container
+	rl, ok := b.resourceLogs[key]
+	if !ok {
+		rl = &resourceLogs{
+			Resource:  resource{Attributes: resourceAttrs(l)},
+			ScopeLogs: []scopeLogs{{Scope: scope{Name: scopeName}}},
+		}
+		b.resourceLogs[key] = rl
+	}
+	rl.ScopeLogs[0].LogRecords = append(rl.ScopeLogs[0].LogRecords, record)
+	b.size++
+}
+
+func (b *exportBatch) Len() int {
+	return b.size
+}
+
+func (b *exportBatch) Encode() ([]byte, error) {
+	req := exportRequest{ResourceLogs: make([]*resourceLogs, 0, len(b.resourceLogs))}
+	for _, rl := range b.resourceLogs {
+		req.ResourceLogs = append(req.ResourceLogs, rl)
+	}
+	return json.Marshal(&req)
+}
+
+// resourceAttrs returns the attributes of the line's container, following the kubernetes semantic conventions.
+//
+// The workload is the pod's controller if the metadata is enabled, otherwise the resource requested.
+func resourceAttrs(l *k8slog.LogLine) []keyValue {
+	attrs := []keyValue{
+		attribute("k8s.namespace.name", l.Namespace),
+		attribute("k8s.pod.name", l.Pod),
+	}
+	if l.Container != "" {
+		attrs = append(attrs, attribute("k8s.container.name", l.Container))
+	}
+	var workload string
+	if l.PodMeta != nil && l.Owner != "" {
+		attrs, workload = ownerAttrs(attrs, l.PodMeta)
+	} else if key, ok := resourceAttributes[l.Type]; ok {
+		attrs = append(attrs, attribute(key, l.Name))
+		workload = l.Name
+	}
+	if workload == "" && l.Type == k8slog.TypeService {
+		workload = l.Name
+	}
+	// the workload names the service
+	if workload != "" {
+		attrs = append(attrs, attribute("service.name", workload))
+	}
+	if l.PodMeta != nil && l.Node != "" {
+		attrs = append(attrs, attribute("k8s.node.name", l.Node))
+	}
+	return attrs
+}
+
+// ownerAttrs adds the attributes of the pod's controller, whatever the resource requested, and returns the name of
+// its workload: the deployment of a replicaset is found with the pod-template-hash label
+func ownerAttrs(attrs []keyValue, meta *k8slog.PodMeta) ([]keyValue, string) {
+	chunks := strings.SplitN(meta.Owner, "/", 2)
+	if len(chunks) != 2 {
+		return attrs, ""
+	}
+	kind, name := chunks[0], chunks[1]
+	key, ok := ownerAttributes[kind]
+	if !ok {
+		return attrs, ""
+	}
+	attrs = append(attrs, attribute(key, name))
+	if hash := meta.Labels["pod-template-hash"]; kind == "replicaset" && hash != "" && strings.HasSuffix(name, "-"+hash) {
+		name = strings.TrimSuffix(name, "-"+hash)
+		attrs = append(attrs, attribute("k8s.deployment.name", name))
+	}
+	return attrs, name
+}
+
+// Flush exports the current batch and waits for the exports to end
+func (e *Exporter) Flush() error {
+	return e.batcher.Flush()
+}
+
+// prepare sets the headers of an export request
+func (e *Exporter) prepare(req *http.Request) {
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// retryable returns true if an export failing with the status can be retried, according to the OTLP specification
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Close exports the remaining records, it returns the error of the last exports, if any
+func (e *Exporter) Close() error {
+	return e.batcher.Close()
+}
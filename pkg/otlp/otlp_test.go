@@ -0,0 +1,184 @@
+package otlp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+// fakeCollector is a local stand-in of an OTLP/HTTP collector
+type fakeCollector struct {
+	mu       sync.Mutex
+	requests []exportRequest
+}
+
+func (f *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var req exportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.Header.Get("Authorization") != "token" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.requests = append(f.requests, req)
+}
+
+func logLine(msg string) k8slog.LogLine {
+	var l k8slog.LogLine
+	l.Namespace = "prod"
+	l.Type = k8slog.TypeDeploy
+	l.Name = "api"
+	l.Kind = k8slog.KindLog
+	l.Time = time.Now()
+	l.Pod = "api-1"
+	l.Container = "app"
+	l.Line = msg + "\n"
+	return l
+}
+
+func newTestExporter(t *testing.T, f *fakeCollector) (*Exporter, func()) {
+	ts := httptest.NewServer(f)
+	e, err := New(ts.URL+"/v1/logs",
+		WithOptsHeaders(map[string]string{"Authorization": "token"}),
+		WithOptsBatch(10, 0),
+		WithOptsRetryTimeout(10*time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, ts.Close
+}
+
+func attrs(kvs []keyValue) map[string]string {
+	ret := make(map[string]string)
+	for _, kv := range kvs {
+		ret[kv.Key] = kv.Value.StringValue
+	}
+	return ret
+}
+
+func TestExport(t *testing.T) {
+	f := &fakeCollector{}
+	e, stop := newTestExporter(t, f)
+	defer stop()
+	e.Write(logLine(`{"level":"error","msg":"boom"}`))
+	e.Write(logLine("just a line"))
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.requests) != 1 {
+		t.Fatalf("%d exports, want 1", len(f.requests))
+	}
+	rls := f.requests[0].ResourceLogs
+	if len(rls) != 1 {
+		t.Fatalf("%d resources, want 1", len(rls))
+	}
+	resAttrs := attrs(rls[0].Resource.Attributes)
+	want := map[string]string{
+		"k8s.namespace.name":  "prod",
+		"k8s.pod.name":        "api-1",
+		"k8s.container.name":  "app",
+		"k8s.deployment.name": "api",
+		"service.name":        "api",
+	}
+	for k, v := range want {
+		if resAttrs[k] != v {
+			t.Errorf("attribute %s = %q, want %q", k, resAttrs[k], v)
+		}
+	}
+	records := rls[0].ScopeLogs[0].LogRecords
+	if len(records) != 2 {
+		t.Fatalf("%d records, want 2", len(records))
+	}
+	if records[0].SeverityNumber != 17 || records[0].SeverityText != "ERROR" {
+		t.Errorf("severity = %d %s, want 17 ERROR", records[0].SeverityNumber, records[0].SeverityText)
+	}
+	if records[1].Body.StringValue != "just a line" || records[1].SeverityNumber != 0 {
+		t.Errorf("record = %+v", records[1])
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for status, want := range map[int]bool{
+		http.StatusBadRequest:          false,
+		http.StatusInternalServerError: false,
+		http.StatusTooManyRequests:     true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusGatewayTimeout:      true,
+	} {
+		if got := retryable(status); got != want {
+			t.Errorf("retryable(%d) = %t, want %t", status, got, want)
+		}
+	}
+}
+
+func TestResourceAttrs(t *testing.T) {
+	tests := []struct {
+		typ  k8slog.ResourceType
+		name string
+		meta *k8slog.PodMeta
+		want map[string]string
+	}{
+		{
+			typ:  k8slog.TypeDeploy,
+			name: "api",
+			want: map[string]string{"k8s.deployment.name": "api", "service.name": "api"},
+		},
+		{
+			typ:  k8slog.TypeService,
+			name: "api-svc",
+			want: map[string]string{"service.name": "api-svc"},
+		},
+		{
+			typ:  k8slog.TypeService,
+			name: "api-svc",
+			meta: &k8slog.PodMeta{Owner: "replicaset/api-5d9c8f7b6", Labels: map[string]string{"pod-template-hash": "5d9c8f7b6"}},
+			want: map[string]string{"k8s.replicaset.name": "api-5d9c8f7b6", "k8s.deployment.name": "api", "service.name": "api"},
+		},
+		{
+			typ:  k8slog.TypePod,
+			name: "db-0",
+			meta: &k8slog.PodMeta{Owner: "statefulset/db", Node: "node-1"},
+			want: map[string]string{"k8s.statefulset.name": "db", "service.name": "db", "k8s.node.name": "node-1"},
+		},
+		{
+			typ:  k8slog.TypePod,
+			name: "fluentd-x2k9p",
+			meta: &k8slog.PodMeta{Owner: "daemonset/fluentd"},
+			want: map[string]string{"k8s.daemonset.name": "fluentd", "service.name": "fluentd"},
+		},
+		{
+			// a replicaset without deployment
+			typ:  k8slog.TypeReplicaSet,
+			name: "web",
+			meta: &k8slog.PodMeta{Owner: "replicaset/web"},
+			want: map[string]string{"k8s.replicaset.name": "web", "service.name": "web"},
+		},
+		{
+			typ:  k8slog.TypePod,
+			name: "static",
+			meta: &k8slog.PodMeta{Owner: "node/node-1"},
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		l := logLine("line")
+		l.Type = tt.typ
+		l.Name = tt.name
+		l.PodMeta = tt.meta
+		got := attrs(resourceAttrs(&l))
+		for _, key := range []string{"k8s.namespace.name", "k8s.pod.name", "k8s.container.name"} {
+			delete(got, key)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s/%s with %+v: attributes %v, want %v", tt.typ, tt.name, tt.meta, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Package redact masks secrets and personal data in log lines
+package redact
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+	"github.com/pkg/errors"
+)
+
+// DefaultMask replaces the redacted values
+const DefaultMask = "[REDACTED]"
+
+// secretGroup is the name of the group of a pattern to mask, instead of the whole match
+const secretGroup = "secret"
+
+// Rule is a pattern of sensitive data
+type Rule struct {
+	// Name identifies the rule
+	Name string
+	// Pattern matches the data, only the group named "secret" is masked if any
+	Pattern *regexp.Regexp
+	// Check validates a match, e.g. with a checksum (optional)
+	Check func(match string) bool
+}
+
+// detectors are the built-in rules, by name
+var detectors = map[string]Rule{
+	"jwt": {
+		Name:    "jwt",
+		Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	},
+	"aws": {
+		Name:    "aws",
+		Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b|(?i:aws_?secret_?access_?key)["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})`),
+	},
+	"auth": {
+		Name:    "auth",
+		Pattern: regexp.MustCompile(`(?i:\b(?:bearer|basic))\s+(?P<secret>[A-Za-z0-9._~+/=-]{8,})`),
+	},
+	"email": {
+		Name:    "email",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	},
+	"card": {
+		Name:    "card",
+		Pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		Check:   luhn,
+	},
+}
+
+// Detectors are the names of the built-in rules:
+//	- jwt: JSON Web Tokens
+//	- aws: AWS access key IDs and secret access keys
+//	- auth: credentials of bearer and basic authorization headers
+//	- email: email addresses
+//	- card: credit card numbers, validated with the Luhn checksum
+var Detectors = []string{"jwt", "aws", "auth", "email", "card"}
+
+// Redactor is a k8slog.Processor masking sensitive data in the log lines
+//
+// It is safe for concurrent use.
+type Redactor struct {
+	mask   string
+	rules  []Rule
+	fields *regexp.Regexp
+}
+
+// Opts is an option used to configure Redactor
+type Opts func(r *Redactor) error
+
+// WithOptsDetectors enables built-in rules, see Detectors (default: none)
+func WithOptsDetectors(names ...string) Opts {
+	return func(r *Redactor) error {
+		for _, name := range names {
+			rule, ok := detectors[name]
+			if !ok {
+				return errors.Errorf("unknown detector %q, must be one of %s", name, strings.Join(Detectors, ", "))
+			}
+			r.rules = append(r.rules, rule)
+		}
+		return nil
+	}
+}
+
+// WithOptsPattern adds a rule masking the matches of a regular expression (default: none).
+//
+// If the expression has a group named secret, e.g. password=(?P<secret>\S+), only this group is masked.
+func WithOptsPattern(pattern string) Opts {
+	return func(r *Redactor) error {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return errors.Wrap(err, "redact pattern")
+		}
+		r.rules = append(r.rules, Rule{Name: pattern, Pattern: re})
+		return nil
+	}
+}
+
+// WithOptsFields masks the string values of these fields in JSON lines, at any depth (default: none)
+func WithOptsFields(fields ...string) Opts {
+	return func(r *Redactor) error {
+		if len(fields) == 0 {
+			return nil
+		}
+		quoted := make([]string, len(fields))
+		for i, field := range fields {
+			quoted[i] = regexp.QuoteMeta(field)
+		}
+		r.fields = regexp.MustCompile(`"(?:` + strings.Join(quoted, "|") + `)"\s*:\s*"(?P<secret>(?:[^"\\]|\\.)*)"`)
+		return nil
+	}
+}
+
+// WithOptsMask configures the string replacing the masked data (default: DefaultMask)
+func WithOptsMask(mask string) Opts {
+	return func(r *Redactor) error {
+		r.mask = mask
+		return nil
+	}
+}
+
+// New creates a new Redactor
+func New(opts ...Opts) (*Redactor, error) {
+	r := &Redactor{mask: DefaultMask}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Redact masks the sensitive data of a string
+func (r *Redactor) Redact(s string) string {
+	if r.fields != nil {
+		s = replace(s, r.fields, nil, r.mask)
+	}
+	for _, rule := range r.rules {
+		s = replace(s, rule.Pattern, rule.Check, r.mask)
+	}
+	return s
+}
+
+// Process implements k8slog.Processor, it masks the message of the line.
+//
+// The parsed fields are parsed again if the message changed, so the JSON output doesn't leak them.
+func (r *Redactor) Process(l *k8slog.LogLine) bool {
+	msg := l.Message()
+	redacted := r.Redact(msg)
+	if redacted == msg {
+		return true
+	}
+	l.SetMessage(redacted)
+	if l.Fields != nil {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(redacted), &fields); err != nil {
+			fields = nil
+		}
+		l.Fields = fields
+	}
+	return true
+}
+
+// replace masks the matches of the pattern accepted by check, or their secret group
+func replace(s string, pattern *regexp.Regexp, check func(string) bool, mask string) string {
+	matches := pattern.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	group := 0
+	for i, name := range pattern.SubexpNames() {
+		if name == secretGroup {
+			group = i
+		}
+	}
+	var buffer strings.Builder
+	last := 0
+	for _, match := range matches {
+		start, end := match[0], match[1]
+		if group > 0 && match[2*group] >= 0 {
+			start, end = match[2*group], match[2*group+1]
+		}
+		if check != nil && !check(s[start:end]) {
+			continue
+		}
+		buffer.WriteString(s[last:start])
+		buffer.WriteString(mask)
+		last = end
+	}
+	buffer.WriteString(s[last:])
+	return buffer.String()
+}
+
+// luhn returns true if the digits of the number, ignoring spaces and dashes, have a valid Luhn checksum
+func luhn(number string) bool {
+	sum, n := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if n%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
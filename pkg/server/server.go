@@ -0,0 +1,375 @@
+// Package server streams the logs of kubernetes resources over HTTP, as Server-Sent Events or WebSocket messages
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+const (
+	// subscriberBuffer is the number of lines buffered per subscriber, lines are dropped when it's full
+	subscriberBuffer = 256
+	// keepAlive is the interval between two keep-alive messages on idle connections
+	keepAlive = 15 * time.Second
+)
+
+// Server streams the logs of the resources requested by its clients.
+//
+// Subscribers of the same resources share one log stream, which is stopped when its last subscriber leaves.
+// Browsers are only allowed from the server's origin and the origins given by WithOptsOrigins.
+//
+// Endpoints:
+//	- /sse: Server-Sent Events, one "log" event per line
+//	- /ws: WebSocket, one JSON message per line
+// Query parameters:
+//	- resource: a resource string (see k8slog.Client.Logs), can be repeated, local sources are refused
+//	- where: only send the lines whose field has the value (field=value, see k8slog.LogLine.Field), can be repeated
+//	- kind: only send the lines of this kind (log, k8s-event, pod-added, ...), can be repeated
+//	- grep: only send the lines containing this string
+type Server struct {
+	// logs streams the logs of the resources until stop is closed, k8slog.Client.LogsUntil
+	logs     func(stop <-chan struct{}, ress ...string) (<-chan k8slog.LogLine, error)
+	origins  []string
+	mu       sync.Mutex
+	hubs     map[string]*hub
+	upgrader websocket.Upgrader
+	mux      *http.ServeMux
+}
+
+// Opts is an option used to configure Server
+type Opts func(s *Server)
+
+// WithOptsOrigins allows the browsers of other origins (e.g. https://dashboard.example.com) to stream the logs,
+// "*" allows any origin (default: none)
+func WithOptsOrigins(origins ...string) Opts {
+	return func(s *Server) {
+		s.origins = origins
+	}
+}
+
+// New creates a new Server streaming logs with the client, which must follow the logs
+func New(klog *k8slog.Client, opts ...Opts) *Server {
+	s := &Server{
+		hubs: make(map[string]*hub),
+		mux:  http.NewServeMux(),
+	}
+	if klog != nil {
+		s.logs = klog.LogsUntil
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.upgrader.CheckOrigin = s.checkOrigin
+	s.mux.HandleFunc("/sse", s.serveSSE)
+	s.mux.HandleFunc("/ws", s.serveWebSocket)
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// checkOrigin returns true if the request doesn't come from a browser of another origin, unless it's allowed
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range s.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribe parses the request and subscribes to the log stream of its resources, starting it if needed
+func (s *Server) subscribe(r *http.Request) (*subscriber, *hub, error) {
+	query := r.URL.Query()
+	ress := query["resource"]
+	if len(ress) == 0 {
+		return nil, nil, fmt.Errorf("missing resource")
+	}
+	for _, res := range ress {
+		// files and the standard input are those of the server's host, not the client's
+		if k8slog.IsLocal(res) {
+			return nil, nil, fmt.Errorf("local sources are not allowed: %s", res)
+		}
+	}
+	f, err := parseFilter(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	sorted := append([]string(nil), ress...)
+	sort.Strings(sorted)
+	key := strings.Join(sorted, ",")
+	s.mu.Lock()
+	h, ok := s.hubs[key]
+	if !ok {
+		h = newHub(key)
+		s.hubs[key] = h
+	}
+	h.refs++
+	// subscribe before dispatching so the first subscriber gets all the lines
+	sub := h.subscribe(f)
+	s.mu.Unlock()
+
+	// the resources are retrieved from kubernetes, the other subscriptions don't wait for it
+	if !ok {
+		out, err := s.logs(h.stop, sorted...)
+		h.start(out, err)
+	}
+	<-h.started
+	if h.err != nil {
+		s.unsubscribe(h, sub)
+		return nil, nil, h.err
+	}
+	return sub, h, nil
+}
+
+// unsubscribe removes the subscriber, the log stream is stopped when its last subscriber leaves
+func (s *Server) unsubscribe(h *hub, sub *subscriber) {
+	h.unsubscribe(sub)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h.refs--
+	if h.refs == 0 {
+		delete(s.hubs, h.key)
+		close(h.stop)
+	}
+}
+
+func (s *Server) serveSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	if !s.checkOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	sub, h, err := s.subscribe(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer s.unsubscribe(h, sub)
+	if origin := r.Header.Get("Origin"); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case line := <-sub.lines:
+			data, err := json.Marshal(line)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: log\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.checkOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	sub, h, err := s.subscribe(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer s.unsubscribe(h, sub)
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already replied
+		return
+	}
+	defer conn.Close()
+
+	// read the messages, to handle the pings and be notified when the connection is closed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(keepAlive)); err != nil {
+				return
+			}
+		case line := <-sub.lines:
+			if err := conn.WriteJSON(&line); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// hub dispatches the lines of a log stream to its subscribers
+type hub struct {
+	key         string
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	// refs is the number of subscriptions, guarded by the server's mutex
+	refs int
+	// stop is closed to stop the log stream
+	stop chan struct{}
+	// started is closed once the log stream is started, or failed to with err
+	started chan struct{}
+	err     error
+}
+
+func newHub(key string) *hub {
+	return &hub{
+		key:         key,
+		subscribers: make(map[*subscriber]struct{}),
+		stop:        make(chan struct{}),
+		started:     make(chan struct{}),
+	}
+}
+
+// start dispatches the lines of the log stream, unless it failed to start
+func (h *hub) start(out <-chan k8slog.LogLine, err error) {
+	h.err = err
+	close(h.started)
+	if err == nil {
+		go h.run(out)
+	}
+}
+
+// subscriber receives the lines matching its filter
+type subscriber struct {
+	filter  filter
+	lines   chan k8slog.LogLine
+	dropped uint64
+}
+
+func (h *hub) subscribe(f filter) *subscriber {
+	sub := &subscriber{filter: f, lines: make(chan k8slog.LogLine, subscriberBuffer)}
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+func (h *hub) unsubscribe(sub *subscriber) {
+	h.mu.Lock()
+	delete(h.subscribers, sub)
+	h.mu.Unlock()
+	if sub.dropped > 0 {
+		log.Printf("%s: %d lines dropped for a slow subscriber", h.key, sub.dropped)
+	}
+}
+
+// run sends the lines to the subscribers until the log stream is stopped, a slow subscriber misses lines
+// instead of stalling the others
+func (h *hub) run(in <-chan k8slog.LogLine) {
+	for line := range in {
+		h.mu.Lock()
+		for sub := range h.subscribers {
+			if !sub.filter.match(&line) {
+				continue
+			}
+			select {
+			case sub.lines <- line:
+			default:
+				sub.dropped++
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// filter selects the lines sent to a subscriber
+type filter struct {
+	where map[string]string
+	kinds []k8slog.Kind
+	grep  string
+}
+
+// parseFilter parses the where, kind and grep query parameters
+func parseFilter(query url.Values) (filter, error) {
+	f := filter{where: make(map[string]string), grep: query.Get("grep")}
+	for _, where := range query["where"] {
+		chunks := strings.SplitN(where, "=", 2)
+		if len(chunks) != 2 || chunks[0] == "" {
+			return f, fmt.Errorf("invalid condition, must be field=value: %s", where)
+		}
+		f.where[chunks[0]] = chunks[1]
+	}
+	for _, name := range query["kind"] {
+		var kind k8slog.Kind
+		if err := kind.UnmarshalText([]byte(name)); err != nil {
+			return f, err
+		}
+		f.kinds = append(f.kinds, kind)
+	}
+	return f, nil
+}
+
+func (f filter) match(line *k8slog.LogLine) bool {
+	if len(f.kinds) > 0 {
+		found := false
+		for _, kind := range f.kinds {
+			found = found || kind == line.Kind
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.grep != "" && !strings.Contains(line.Line, f.grep) {
+		return false
+	}
+	// like --where, lines without metadata (kubernetes events) always match
+	if line.PodMeta == nil {
+		return true
+	}
+	for field, value := range f.where {
+		if v, ok := line.Field(field); !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
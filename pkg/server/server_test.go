@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		origins []string
+		origin  string
+		allowed bool
+	}{
+		{origin: "", allowed: true},
+		{origin: "http://logs.example.com:8080", allowed: true},
+		{origin: "http://evil.example.com"},
+		{origins: []string{"https://dashboard.example.com"}, origin: "https://dashboard.example.com", allowed: true},
+		{origins: []string{"https://dashboard.example.com"}, origin: "http://dashboard.example.com"},
+		{origins: []string{"*"}, origin: "http://evil.example.com", allowed: true},
+	}
+	for _, tt := range tests {
+		s := New(nil, WithOptsOrigins(tt.origins...))
+		r := httptest.NewRequest("GET", "http://logs.example.com:8080/sse", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if allowed := s.checkOrigin(r); allowed != tt.allowed {
+			t.Errorf("origin %q with %v allowed = %v, want %v", tt.origin, tt.origins, allowed, tt.allowed)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		err   bool
+	}{
+		{query: "where=label.app=api&kind=log&kind=k8s-event&grep=error"},
+		{query: "where=app", err: true},
+		{query: "where==api", err: true},
+		{query: "kind=nope", err: true},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		_, err := parseFilter(query)
+		if (err != nil) != tt.err {
+			t.Errorf("parseFilter(%q) error = %v, want error %v", tt.query, err, tt.err)
+		}
+	}
+
+	query, _ := url.ParseQuery("kind=log&grep=error")
+	f, _ := parseFilter(query)
+	lines := []struct {
+		line  k8slog.LogLine
+		match bool
+	}{
+		{line: k8slog.LogLine{Kind: k8slog.KindLog, Line: "an error\n"}, match: true},
+		{line: k8slog.LogLine{Kind: k8slog.KindLog, Line: "all good\n"}},
+		{line: k8slog.LogLine{Kind: k8slog.KindPodAdded, Line: "error\n"}},
+	}
+	for _, tt := range lines {
+		if match := f.match(&tt.line); match != tt.match {
+			t.Errorf("match(%q) = %v, want %v", tt.line.Line, match, tt.match)
+		}
+	}
+}
+
+// fakeLogs streams a line for each resource, then waits for the stream to be stopped
+func fakeLogs(stop <-chan struct{}, ress ...string) (<-chan k8slog.LogLine, error) {
+	out := make(chan k8slog.LogLine)
+	go func() {
+		defer close(out)
+		for _, res := range ress {
+			out <- k8slog.LogLine{Kind: k8slog.KindLog, Pod: res, Line: "first line\n"}
+		}
+		<-stop
+	}()
+	return out, nil
+}
+
+func TestStreamStoppedWithLastSubscriber(t *testing.T) {
+	s := New(nil)
+	s.logs = fakeLogs
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/sse?resource=prod/deploy/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd := bufio.NewReader(resp.Body)
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(line, "data: ") {
+			if !strings.Contains(line, "first line") {
+				t.Errorf("data = %s", line)
+			}
+			break
+		}
+	}
+	s.mu.Lock()
+	if len(s.hubs) != 1 {
+		t.Errorf("%d hubs, want 1", len(s.hubs))
+	}
+	s.mu.Unlock()
+
+	resp.Body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		n := len(s.hubs)
+		s.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the stream wasn't stopped after the last subscriber left")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	r, _ := http.NewRequest("GET", ts.URL+"/sse?resource=prod/deploy/api", nil)
+	r.Header.Set("Origin", "http://evil.example.com")
+	resp, err = http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status = %d for another origin, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
+
+func TestLocalSourcesRefused(t *testing.T) {
+	s := New(nil)
+	s.logs = func(stop <-chan struct{}, ress ...string) (<-chan k8slog.LogLine, error) {
+		t.Errorf("logs of %q requested", ress)
+		return fakeLogs(stop, ress...)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	for _, res := range []string{"file:/etc/shadow", "-", "prod/deploy/api&resource=file:/etc/passwd"} {
+		for _, endpoint := range []string{"/sse", "/ws"} {
+			resp, err := http.Get(ts.URL + endpoint + "?resource=" + res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "local sources are not allowed") {
+				t.Errorf("%s?resource=%s: status %d, %q, want %d", endpoint, res, resp.StatusCode, body, http.StatusBadRequest)
+			}
+		}
+	}
+}
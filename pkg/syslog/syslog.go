@@ -0,0 +1,224 @@
+// Package syslog sends log lines to a syslog server, in the RFC5424 format
+package syslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// sdID is the id of the structured data element, 32473 is the private enterprise number reserved for examples
+	sdID = "k8s@32473"
+	// dialTimeout is the timeout to connect to the server
+	dialTimeout = 10 * time.Second
+)
+
+// facilities are the syslog facilities by name
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// severities are the syslog severities of the levels
+var severities = map[k8slog.Level]int{
+	k8slog.LevelTrace: 7, // debug
+	k8slog.LevelDebug: 7, // debug
+	k8slog.LevelInfo:  6, // informational
+	k8slog.LevelWarn:  4, // warning
+	k8slog.LevelError: 3, // error
+	k8slog.LevelFatal: 2, // critical
+}
+
+// Sink sends the log lines to a syslog server over UDP, TCP or TLS.
+//
+// Messages have the APP-NAME of the resource, the MSGID of the container, the HOSTNAME of the node
+// (if the metadata is enabled) and structured data with the namespace, pod and container.
+// The severity is detected from the line, lines without level are informational, or errors on stderr.
+// Over TCP and TLS, messages are framed with octet counting (RFC6587). Only the log lines are sent, not the events.
+type Sink struct {
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+	facility  int
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// Opts is an option used to configure Sink
+type Opts func(s *Sink) error
+
+// WithOptsFacility configures the facility of the messages, e.g. local0 (default: user)
+func WithOptsFacility(name string) Opts {
+	return func(s *Sink) error {
+		facility, ok := facilities[name]
+		if !ok {
+			return fmt.Errorf("unknown syslog facility: %s", name)
+		}
+		s.facility = facility
+		return nil
+	}
+}
+
+// WithOptsTLSConfig configures the TLS connections (default: system's root CAs)
+func WithOptsTLSConfig(config *tls.Config) Opts {
+	return func(s *Sink) error {
+		s.tlsConfig = config
+		return nil
+	}
+}
+
+// New creates a new Sink sending to the server at the given address: udp://host:port, tcp://host:port or tls://host:port
+func New(address string, opts ...Opts) (*Sink, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "syslog")
+	}
+	switch u.Scheme {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("invalid syslog address, must be udp://, tcp:// or tls://: %s", address)
+	}
+	s := &Sink{network: u.Scheme, addr: u.Host, facility: facilities["user"]}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.connect(); err != nil {
+		return nil, errors.Wrap(err, "syslog")
+	}
+	return s, nil
+}
+
+func (s *Sink) connect() error {
+	var conn net.Conn
+	var err error
+	if s.network == "tls" {
+		config := s.tlsConfig
+		if config == nil {
+			config = &tls.Config{}
+		}
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", s.addr, config)
+	} else {
+		conn, err = net.DialTimeout(s.network, s.addr, dialTimeout)
+	}
+	if err != nil {
+		return errors.Wrap(err, "connect")
+	}
+	s.conn = conn
+	return nil
+}
+
+// Write sends the line, the connection is reopened once if it fails
+func (s *Sink) Write(l k8slog.LogLine) error {
+	if l.Kind != k8slog.KindLog {
+		return nil
+	}
+	msg := s.format(&l)
+	if s.network != "udp" {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		if _, err := s.conn.Write(msg); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	if err := s.connect(); err != nil {
+		return err
+	}
+	_, err := s.conn.Write(msg)
+	return errors.Wrap(err, "write")
+}
+
+// Flush does nothing, the lines are sent by Write
+func (s *Sink) Flush() error {
+	return nil
+}
+
+// Close closes the connection
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return errors.Wrap(err, "close")
+}
+
+// format returns the RFC5424 message of the line:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [STRUCTURED-DATA] MSG
+func (s *Sink) format(l *k8slog.LogLine) []byte {
+	msg := l.Message()
+	level := k8slog.DetectLevel(msg)
+	severity, ok := severities[level]
+	if !ok {
+		severity = 6
+		if l.Stream == "stderr" {
+			severity = 3
+		}
+	}
+	t := l.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	hostname := "-"
+	if l.PodMeta != nil && l.Node != "" {
+		hostname = l.Node
+	}
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "<%d>1 %s %s %s - %s ",
+		s.facility*8+severity,
+		t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		header(hostname, 255),
+		header(l.Name, 48),
+		header(l.Container, 32),
+	)
+	fmt.Fprintf(&buffer, `[%s namespace="%s" pod="%s"`, sdID, sdEscape(l.Namespace), sdEscape(l.Pod))
+	if l.Container != "" {
+		fmt.Fprintf(&buffer, ` container="%s"`, sdEscape(l.Container))
+	}
+	buffer.WriteString("] ")
+	buffer.WriteString(msg)
+	return buffer.Bytes()
+}
+
+// header returns a header field: printable ASCII without spaces, truncated, "-" if empty
+func header(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(value) > max {
+		value = value[:max]
+	}
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// sdEscape escapes a structured data parameter value
+func sdEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
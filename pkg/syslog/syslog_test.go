@@ -0,0 +1,226 @@
+package syslog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nouney/k8slog/pkg/k8slog"
+)
+
+func logLine(msg string) k8slog.LogLine {
+	var l k8slog.LogLine
+	l.Namespace = "prod"
+	l.Type = k8slog.TypeDeploy
+	l.Name = "api"
+	l.Kind = k8slog.KindLog
+	l.Time = time.Date(2024, 1, 2, 3, 4, 5, 678000000, time.UTC)
+	l.Pod = "api-1"
+	l.Container = "app"
+	l.Line = "2024-01-02T03:04:05.678Z " + msg + "\n"
+	return l
+}
+
+func TestFormat(t *testing.T) {
+	s := &Sink{facility: facilities["local0"]}
+	l := logLine(`{"level":"error","msg":"boom"}`)
+	l.PodMeta = &k8slog.PodMeta{Node: "node-1"}
+	want := `<131>1 2024-01-02T03:04:05.678000Z node-1 api - app [k8s@32473 namespace="prod" pod="api-1" container="app"] {"level":"error","msg":"boom"}`
+	if got := string(s.format(&l)); got != want {
+		t.Errorf("format = %s\nwant     %s", got, want)
+	}
+
+	// local0 is 16, the PRI is facility*8+severity
+	tests := []struct {
+		msg    string
+		stream string
+		pri    string
+	}{
+		{msg: "WARN: disk almost full", pri: "<132>"},
+		{msg: "level=debug msg=tick", pri: "<135>"},
+		{msg: "just a line", pri: "<134>"},
+		// lines without level are errors on stderr
+		{msg: "just a line", stream: "stderr", pri: "<131>"},
+		{msg: "INFO: on stderr", stream: "stderr", pri: "<134>"},
+	}
+	for _, tt := range tests {
+		l := logLine(tt.msg)
+		l.Stream = tt.stream
+		if got := string(s.format(&l)); !strings.HasPrefix(got, tt.pri+"1 ") {
+			t.Errorf("format(%q on %q) = %s, want the PRI %s", tt.msg, tt.stream, got, tt.pri)
+		}
+	}
+}
+
+func TestFormatHeaders(t *testing.T) {
+	s := &Sink{facility: facilities["user"]}
+	l := logLine("hello")
+	l.Name = strings.Repeat("a", 60)
+	l.Container = "my container"
+	l.Pod = `api"1]\`
+	want := `<14>1 2024-01-02T03:04:05.678000Z - ` + strings.Repeat("a", 48) + ` - my_container [k8s@32473 namespace="prod" pod="api\"1\]\\" container="my container"] hello`
+	if got := string(s.format(&l)); got != want {
+		t.Errorf("format = %s\nwant     %s", got, want)
+	}
+	// the container of a local source is empty
+	l.Container = ""
+	want = `<14>1 2024-01-02T03:04:05.678000Z - ` + strings.Repeat("a", 48) + ` - - [k8s@32473 namespace="prod" pod="api\"1\]\\"] hello`
+	if got := string(s.format(&l)); got != want {
+		t.Errorf("format = %s\nwant     %s", got, want)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	tests := []struct {
+		value string
+		max   int
+		want  string
+	}{
+		{value: "api", max: 48, want: "api"},
+		{value: "", max: 48, want: "-"},
+		{value: "a b\tc", max: 48, want: "a_b_c"},
+		{value: "café", max: 48, want: "caf_"},
+		{value: "abcdef", max: 4, want: "abcd"},
+	}
+	for _, tt := range tests {
+		if got := header(tt.value, tt.max); got != tt.want {
+			t.Errorf("header(%q, %d) = %q, want %q", tt.value, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestSDEscape(t *testing.T) {
+	tests := map[string]string{
+		"api-1":        "api-1",
+		`say "hi"`:     `say \"hi\"`,
+		`a]b`:          `a\]b`,
+		`C:\logs`:      `C:\\logs`,
+		`\"]`:          `\\\"\]`,
+		"unicode: é ✓": "unicode: é ✓",
+	}
+	for value, want := range tests {
+		if got := sdEscape(value); got != want {
+			t.Errorf("sdEscape(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+// readFrame reads an octet counted message (RFC6587)
+func readFrame(rd *bufio.Reader) (string, error) {
+	size, err := rd.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, n)
+	_, err = io.ReadFull(rd, msg)
+	return string(msg), err
+}
+
+func TestTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				close(conns)
+				return
+			}
+			conns <- conn
+		}
+	}()
+	s, err := New("tcp://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	conn := <-conns
+	defer conn.Close()
+
+	// events aren't sent
+	event := logLine("new pod")
+	event.Kind = k8slog.KindPodAdded
+	s.Write(event)
+	for _, msg := range []string{"first", "second\nline"} {
+		if err := s.Write(logLine(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rd := bufio.NewReader(conn)
+	for _, want := range []string{"first", "second\nline"} {
+		msg, err := readFrame(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(msg, "] "+want) {
+			t.Errorf("message %q, want %q", msg, want)
+		}
+	}
+
+	// the connection is reopened once when a write fails
+	s.conn.Close()
+	if err := s.Write(logLine("after reconnection")); err != nil {
+		t.Fatal(err)
+	}
+	reconn, ok := <-conns
+	if !ok {
+		t.Fatal("no reconnection")
+	}
+	defer reconn.Close()
+	msg, err := readFrame(bufio.NewReader(reconn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(msg, "] after reconnection") {
+		t.Errorf("message %q after the reconnection", msg)
+	}
+}
+
+func TestUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	s, err := New("udp://" + pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Write(logLine("hello")); err != nil {
+		t.Fatal(err)
+	}
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2048)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a datagram is a message, without framing
+	if msg := string(buf[:n]); !strings.HasPrefix(msg, "<14>1 ") || !strings.HasSuffix(msg, "] hello") {
+		t.Errorf("message %q", msg)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, address := range []string{"localhost:514", "http://localhost:514"} {
+		if _, err := New(address); err == nil {
+			t.Errorf("New(%q) succeeded", address)
+		}
+	}
+	if _, err := New("udp://127.0.0.1:514", WithOptsFacility("nope")); err == nil {
+		t.Error("New succeeded with an unknown facility")
+	}
+}